@@ -0,0 +1,35 @@
+// Command auditverify checks the hash chain of an audit file and prints the
+// hash of its last record. Keep that hash somewhere else and pass it as -head
+// on a later run: if the trail no longer contains it, records were cut off the end.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/audit"
+)
+
+func main() {
+	path := flag.String("file", "logs/audit.log", "audit file to verify")
+	anchor := flag.String("head", "", "head hash printed by an earlier run, the trail must still contain it")
+	flag.Parse()
+
+	anchored := *anchor == ""
+	count, head, err := audit.Verify(func(fn func(audit.Record) bool) error {
+		return audit.ScanFile(*path, func(record audit.Record) bool {
+			anchored = anchored || record.Hash == *anchor
+			return fn(record)
+		})
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit trail %s is broken after %d valid records: %v\n", *path, count, err)
+		os.Exit(1)
+	}
+	if !anchored {
+		fmt.Fprintf(os.Stderr, "Audit trail %s no longer contains the record with hash %s\n", *path, *anchor)
+		os.Exit(1)
+	}
+	fmt.Printf("Audit trail %s is intact: %d records, head %s\n", *path, count, head)
+}
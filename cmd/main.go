@@ -1,20 +1,149 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/observability"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
 )
 
 func main() {
-	config.LoadEnv()
-	port := os.Getenv("SERVER_PORT")
-	router := config.GrpcSetUp()
-	corsHandler := di.CORS(router)
-	// http.Handle("/metrics", promhttp.Handler())
-	log.Println("API Gateway running on port 8080")
-	log.Fatal(http.ListenAndServe(port, corsHandler))
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	stopTracing, err := observability.StartTracing(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("Failed to set up tracing:", err)
+	}
+	keys, err := cfg.JWT.KeyManager()
+	if err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	middleware.UseKeyManager(keys)
+	middleware.UseTokenSources(cfg.JWT.Sources(), cfg.JWT.QueryParam)
+	middleware.UsePermissions(cfg.Permissions)
+	middleware.UseMFAIssuer(cfg.Security.MFAIssuer)
+	useLoginLimits(middleware.NewMemoryAttemptStore(), cfg)
+
+	runtime := config.NewRuntime(cfg, os.Args[1:])
+	runtime.OnReload(func(next *config.Config) (config.Change, error) {
+		// keep the failure counters, only the limits change
+		return config.Change{Commit: func() {
+			useLoginLimits(middleware.CurrentLoginGuard().Store, next)
+		}}, nil
+	})
+	runtime.OnReload(func(next *config.Config) (config.Change, error) {
+		// Tokens carry their scopes, new permissions apply to tokens issued from now on
+		return config.Change{Commit: func() {
+			middleware.UsePermissions(next.Permissions)
+		}}, nil
+	})
+	gw := gateway.GrpcSetUp(runtime)
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	go runtime.Watch(watchCtx)
+
+	corsHandler := di.CORS(gw.Router, gw.Router, func(r *http.Request) di.CORSPolicy {
+		return runtime.SnapshotFrom(r.Context()).Config.CORS
+	})
+	handler := di.HSTS(corsHandler, cfg.Server.TLS.HSTS.HSTSHeader())
+	handler = di.Metrics(handler)
+	handler = di.AccessLog(handler, gw.Logger)
+	handler = di.Tracing(handler)
+	handler = di.Route(handler, gw.Router)
+	handler = di.RequestID(handler)
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           runtime.Middleware(handler),
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
+	}
+
+	var redirectServer *http.Server
+	if cfg.Server.TLS.Enabled() {
+		certs, err := utils.NewCertReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+		if err != nil {
+			log.Fatal("Failed to load TLS certificate:", err)
+		}
+		go certs.Watch(watchCtx, cfg.Server.TLS.ReloadInterval)
+		if server.TLSConfig, err = cfg.Server.TLS.ServerTLSConfig(certs.GetCertificate); err != nil {
+			log.Fatal("Invalid TLS settings:", err)
+		}
+		if cfg.Server.TLS.RedirectAddr != "" {
+			redirectServer = &http.Server{
+				Addr:              cfg.Server.TLS.RedirectAddr,
+				Handler:           di.RedirectToHTTPS(cfg.Server.Addr),
+				ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+				IdleTimeout:       cfg.Server.IdleTimeout,
+			}
+		}
+	}
+
+	serverErr := make(chan error, 2)
+	go func() {
+		if server.TLSConfig != nil {
+			log.Println("API Gateway running with TLS on", cfg.Server.Addr)
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		log.Println("API Gateway running on", cfg.Server.Addr)
+		serverErr <- server.ListenAndServe()
+	}()
+	if redirectServer != nil {
+		go func() {
+			log.Println("Redirecting HTTP to HTTPS on", redirectServer.Addr)
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	select {
+	case err := <-serverErr:
+		log.Fatal(err)
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down", sig)
+	}
+	stopWatching()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	// Shutdown does not track hijacked WebSocket connections, close the chats alongside it
+	chatsClosed := make(chan struct{})
+	go func() {
+		di.CloseChats("server shutting down", cfg.Server.ShutdownTimeout)
+		close(chatsClosed)
+	}()
+	if redirectServer != nil {
+		redirectServer.Shutdown(ctx)
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("HTTP server did not drain in time:", err)
+	}
+	<-chatsClosed
+	gw.Close()
+	if err := stopTracing(ctx); err != nil {
+		log.Println("Failed to flush traces:", err)
+	}
+	log.Println("API Gateway stopped")
+}
+
+func useLoginLimits(store middleware.AttemptStore, cfg *config.Config) {
+	guard := middleware.NewLoginGuard(store)
+	guard.EmailLimits = cfg.RateLimits.LoginEmail
+	guard.IPLimits = cfg.RateLimits.LoginIP
+	guard.TrustForwardedFor = cfg.Server.TrustForwardedFor
+	middleware.UseLoginGuard(guard)
 }
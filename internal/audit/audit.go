@@ -0,0 +1,163 @@
+// Package audit keeps a tamper-evident trail of admin and clinical actions.
+// Every record carries the hash of the record before it, so editing,
+// reordering or removing a record breaks the chain from that point on.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
+)
+
+// Audited actions
+const (
+	ActionDoctorRegister  = "doctor.register"
+	ActionDoctorDelete    = "doctor.delete"
+	ActionPatientDelete   = "patient.delete"
+	ActionPatientBlock    = "patient.block"
+	ActionPrescriptionAdd = "prescription.add"
+)
+
+// Outcomes of an action
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// GenesisHash is the previous hash of the first record
+var GenesisHash = hex.EncodeToString(make([]byte, sha256.Size))
+
+// Record is one audited action
+type Record struct {
+	Seq       uint64    `json:"seq"`
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor"`
+	Role      string    `json:"role"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	RequestID string    `json:"request_id"`
+	Outcome   string    `json:"outcome"`
+	// PrevHash is the hash of the record before, GenesisHash for the first one
+	PrevHash string `json:"prev_hash"`
+	// Hash covers every other field, PrevHash included
+	Hash string `json:"hash"`
+}
+
+// ComputeHash returns the hash the record should carry
+func (r Record) ComputeHash() string {
+	r.Hash = ""
+	data, _ := json.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sink stores the records. Records must come back from Scan in the order they were appended.
+type Sink interface {
+	Append(Record) error
+	// Last returns the newest record, ok is false while the sink is empty
+	Last() (record Record, ok bool, err error)
+	// Scan calls fn with every record in order until fn returns false. It may
+	// run while records are appended and must not return a partial record.
+	Scan(fn func(Record) bool) error
+	Close() error
+}
+
+// Trail chains the records and writes them to a sink. A sink must only be
+// written by one trail, two gateways sharing a file would fork the chain.
+type Trail struct {
+	mu     sync.Mutex
+	sink   Sink
+	last   Record
+	logger *logrus.Logger
+}
+
+// New continues the chain of the records already in the sink. Records that
+// cannot be stored are reported to logger.
+func New(sink Sink, logger *logrus.Logger) (*Trail, error) {
+	last, ok, err := sink.Last()
+	if err != nil {
+		return nil, fmt.Errorf("read last audit record: %v", err)
+	}
+	if !ok {
+		last = Record{Hash: GenesisHash}
+	}
+	return &Trail{sink: sink, last: last, logger: logger}, nil
+}
+
+// Append chains the record to the trail and stores it. The chain only moves
+// on once the sink has the record, a failed record is not part of it.
+func (t *Trail) Append(record Record) (Record, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	record.Seq = t.last.Seq + 1
+	record.Time = record.Time.UTC()
+	record.PrevHash = t.last.Hash
+	record.Hash = record.ComputeHash()
+	if err := t.sink.Append(record); err != nil {
+		return Record{}, err
+	}
+	t.last = record
+	return record, nil
+}
+
+func (t *Trail) Close() error {
+	return t.sink.Close()
+}
+
+var (
+	trailMu sync.RWMutex
+	trail   *Trail
+)
+
+// Use sets the trail the handlers record to, nil stops recording
+func Use(t *Trail) {
+	trailMu.Lock()
+	defer trailMu.Unlock()
+	trail = t
+}
+
+// Log records an action of the authenticated user of ctx on target. A record
+// that cannot be stored is reported in the log, the action itself has
+// already happened upstream.
+func Log(ctx context.Context, action, target, outcome string) {
+	trailMu.RLock()
+	t := trail
+	trailMu.RUnlock()
+	if t == nil {
+		return
+	}
+	_, err := t.Append(Record{
+		Time:      time.Now(),
+		Actor:     middleware.UserIDFrom(ctx),
+		Role:      middleware.RoleFrom(ctx),
+		Action:    action,
+		Target:    target,
+		RequestID: utils.RequestIDFrom(ctx),
+		Outcome:   outcome,
+	})
+	if err != nil {
+		t.logger.WithContext(ctx).WithFields(logrus.Fields{
+			"function": "Log",
+			"action":   action,
+			"target":   target,
+			"error":    err.Error(),
+		}).Error("Failed to write audit record")
+	}
+}
+
+// OutcomeOf classifies an upstream call by its error and response status code
+func OutcomeOf(err error, statusCode int32) string {
+	if err != nil || statusCode >= 400 {
+		return OutcomeFailure
+	}
+	return OutcomeSuccess
+}
@@ -0,0 +1,191 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxRecordSize bounds one line of the audit file
+const maxRecordSize = 1 << 20
+
+// FileSink appends the records to a local file, one JSON object per line,
+// and syncs the file after every record
+type FileSink struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	// size is the length of the complete records, scans stop there so they
+	// never see a record that is still being written
+	size int64
+	// broken is set when a failed append could not be cut off again, later
+	// records would be glued to its remains
+	broken error
+}
+
+// NewFileSink opens the audit file for appending, creating it and its
+// directory when missing. A record cut short by a crash is repaired first.
+func NewFileSink(path string, logger *logrus.Logger) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	if err := repairTail(path, logger); err != nil {
+		return nil, fmt.Errorf("repair %s: %v", path, err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileSink{path: path, file: file, size: info.Size()}, nil
+}
+
+// repairTail deals with a last line that has no newline, which is what a
+// crash in the middle of Append leaves behind. A complete record only lost its
+// newline and is kept, anything else is a partial record and is cut off, it
+// was never acknowledged to the caller. Both cases are logged.
+func repairTail(path string, logger *logrus.Logger) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	if size == 0 {
+		return nil
+	}
+	start := size - maxRecordSize
+	if start < 0 {
+		start = 0
+	}
+	tail := make([]byte, size-start)
+	if _, err := file.ReadAt(tail, start); err != nil && err != io.EOF {
+		return err
+	}
+	if tail[len(tail)-1] == '\n' {
+		return nil
+	}
+	cut := bytes.LastIndexByte(tail, '\n') + 1
+	fragment := tail[cut:]
+
+	var record Record
+	if json.Unmarshal(fragment, &record) == nil && record.Hash != "" {
+		logger.WithFields(logrus.Fields{
+			"function": "repairTail",
+			"file":     path,
+			"seq":      record.Seq,
+		}).Warn("Audit file ended without a newline after its last record, completing the line")
+		_, err := file.WriteAt([]byte{'\n'}, size)
+		return err
+	}
+	logger.WithFields(logrus.Fields{
+		"function": "repairTail",
+		"file":     path,
+		"bytes":    len(fragment),
+	}).Warn("Audit file ends with a partly written record, cutting it off; the records before it are kept")
+	if err := file.Truncate(start + int64(cut)); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// Append writes the record and syncs it. When either fails the file is cut
+// back to the records before, so a record the caller was told failed never
+// stays in the file and a retry does not fork the chain.
+func (s *FileSink) Append(record Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken != nil {
+		return s.broken
+	}
+	n, err := s.file.Write(append(data, '\n'))
+	if err == nil {
+		err = s.file.Sync()
+	}
+	if err != nil {
+		if terr := s.file.Truncate(s.size); terr != nil {
+			s.broken = fmt.Errorf("%s ends with a failed record that could not be cut off: %v", s.path, terr)
+		}
+		return err
+	}
+	s.size += int64(n)
+	return nil
+}
+
+func (s *FileSink) Last() (Record, bool, error) {
+	var last Record
+	found := false
+	err := s.Scan(func(record Record) bool {
+		last, found = record, true
+		return true
+	})
+	return last, found, err
+}
+
+// Scan reads the records complete when it is called, appends can go on meanwhile
+func (s *FileSink) Scan(fn func(Record) bool) error {
+	s.mu.Lock()
+	size := s.size
+	s.mu.Unlock()
+	file, err := os.Open(s.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return scanRecords(io.LimitReader(file, size), s.path, fn)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// ScanFile reads the records of an audit file without opening it for writing
+func ScanFile(path string, fn func(Record) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return scanRecords(file, path, fn)
+}
+
+func scanRecords(r io.Reader, path string, fn func(Record) bool) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+		if !fn(record) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,112 @@
+package audit
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// Query limits
+const (
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+// Query selects records, empty fields match everything
+type Query struct {
+	Actor  string
+	Target string
+	// From and To bound the record time, From inclusive and To exclusive
+	From time.Time
+	To   time.Time
+	// Limit keeps the newest matching records
+	Limit int
+}
+
+func (q Query) matches(record Record) bool {
+	return (q.Actor == "" || record.Actor == q.Actor) &&
+		(q.Target == "" || record.Target == q.Target) &&
+		(q.From.IsZero() || !record.Time.Before(q.From)) &&
+		(q.To.IsZero() || record.Time.Before(q.To))
+}
+
+// Find returns the newest records matching q, oldest first, and whether
+// older matching records were left out. It does not hold up appends, the
+// sink only scans the records complete when the search started.
+func (t *Trail) Find(q Query) ([]Record, bool, error) {
+	var records []Record
+	truncated := false
+	err := t.sink.Scan(func(record Record) bool {
+		if !q.matches(record) {
+			return true
+		}
+		if len(records) == q.Limit {
+			records = records[1:]
+			truncated = true
+		}
+		records = append(records, record)
+		return true
+	})
+	return records, truncated, err
+}
+
+// QueryHandler lets admins search the trail by actor, target and time range,
+// for example ?actor=ADM1&from=2024-11-01T00:00:00Z&to=2024-12-01T00:00:00Z&limit=50
+func (t *Trail) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		utils.JSONStandardResponse(w, "fail", err.Error(), "", http.StatusBadRequest, r)
+		return
+	}
+	records, truncated, err := t.Find(q)
+	if err != nil {
+		utils.JSONStandardResponse(w, "error", "Failed to read the audit trail", "", http.StatusInternalServerError, r)
+		return
+	}
+	if records == nil {
+		records = []Record{}
+	}
+	utils.JSONResponse(w, map[string]interface{}{
+		"records":   records,
+		"count":     len(records),
+		"truncated": truncated,
+	}, http.StatusOK, r)
+}
+
+func parseQuery(r *http.Request) (Query, error) {
+	values := r.URL.Query()
+	q := Query{
+		Actor:  values.Get("actor"),
+		Target: values.Get("target"),
+		Limit:  defaultQueryLimit,
+	}
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{
+		{"from", &q.From},
+		{"to", &q.To},
+	} {
+		if raw := values.Get(bound.name); raw != "" {
+			parsed, err := time.Parse(time.RFC3339, raw)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 time", bound.name)
+			}
+			*bound.value = parsed
+		}
+	}
+	if !q.From.IsZero() && !q.To.IsZero() && !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxQueryLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxQueryLimit)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
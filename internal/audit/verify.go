@@ -0,0 +1,33 @@
+package audit
+
+import "fmt"
+
+// Verify walks the records in order and checks that every record carries
+// the next sequence number, the hash of the record before it and its own
+// correct hash. It returns the number of records and the last hash, which
+// can be kept elsewhere to also detect records cut off the end.
+func Verify(scan func(func(Record) bool) error) (int, string, error) {
+	count := 0
+	previous := Record{Hash: GenesisHash}
+	var broken error
+	err := scan(func(record Record) bool {
+		switch {
+		case record.Seq != previous.Seq+1:
+			broken = fmt.Errorf("record %d follows record %d, records are missing or reordered", record.Seq, previous.Seq)
+		case record.PrevHash != previous.Hash:
+			broken = fmt.Errorf("record %d does not chain to record %d", record.Seq, previous.Seq)
+		case record.Hash != record.ComputeHash():
+			broken = fmt.Errorf("record %d was modified, its hash does not match", record.Seq)
+		}
+		if broken != nil {
+			return false
+		}
+		count++
+		previous = record
+		return true
+	})
+	if err != nil {
+		return count, previous.Hash, err
+	}
+	return count, previous.Hash, broken
+}
@@ -0,0 +1,281 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// writeTrail appends n records to a new audit file and returns its lines and
+// the hash of the last record
+func writeTrail(t *testing.T, path string, n int) ([]string, string) {
+	t.Helper()
+	sink, err := NewFileSink(path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	trail, err := New(sink, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last Record
+	for i := 0; i < n; i++ {
+		last, err = trail.Append(Record{
+			Time:    time.Date(2026, 1, 1, 9, i, 0, 0, time.UTC),
+			Actor:   "admin-1",
+			Role:    "admin",
+			Action:  ActionPatientBlock,
+			Target:  "patient-" + string(rune('a'+i)),
+			Outcome: OutcomeSuccess,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trail.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"), last.Hash
+}
+
+// editRecord changes record i of lines with edit and, when rehash is set,
+// gives it the hash that matches its new content
+func editRecord(t *testing.T, lines []string, i int, rehash bool, edit func(*Record)) {
+	t.Helper()
+	var record Record
+	if err := json.Unmarshal([]byte(lines[i]), &record); err != nil {
+		t.Fatal(err)
+	}
+	edit(&record)
+	if rehash {
+		record.Hash = record.ComputeHash()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines[i] = string(data)
+}
+
+func TestVerifyTamperedTrail(t *testing.T) {
+	tests := []struct {
+		name      string
+		tamper    func(t *testing.T, lines []string) []string
+		wantCount int
+		wantErr   string
+		// wantLastChanged is set when only the kept last hash reveals the change
+		wantLastChanged bool
+	}{
+		{
+			name:      "untouched",
+			tamper:    func(t *testing.T, lines []string) []string { return lines },
+			wantCount: 4,
+		},
+		{
+			name: "edited record",
+			tamper: func(t *testing.T, lines []string) []string {
+				editRecord(t, lines, 1, false, func(r *Record) { r.Outcome = OutcomeFailure })
+				return lines
+			},
+			wantCount: 1,
+			wantErr:   "record 2 was modified",
+		},
+		{
+			name: "edited record with a recomputed hash",
+			tamper: func(t *testing.T, lines []string) []string {
+				editRecord(t, lines, 1, true, func(r *Record) { r.Actor = "admin-2" })
+				return lines
+			},
+			wantCount: 2,
+			wantErr:   "record 3 does not chain to record 2",
+		},
+		{
+			name: "removed record",
+			tamper: func(t *testing.T, lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantCount: 1,
+			wantErr:   "record 3 follows record 1",
+		},
+		{
+			name: "swapped records",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantCount: 1,
+			wantErr:   "record 3 follows record 1",
+		},
+		{
+			name: "renumbered records after a removal",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines = append(lines[:1], lines[2:]...)
+				for i := 1; i < len(lines); i++ {
+					editRecord(t, lines, i, true, func(r *Record) { r.Seq = uint64(i + 1) })
+				}
+				return lines
+			},
+			wantCount: 1,
+			wantErr:   "record 2 does not chain to record 1",
+		},
+		{
+			name: "truncated trail",
+			tamper: func(t *testing.T, lines []string) []string {
+				return lines[:3]
+			},
+			wantCount:       3,
+			wantLastChanged: true,
+		},
+		{
+			name: "garbled line",
+			tamper: func(t *testing.T, lines []string) []string {
+				lines[2] = lines[2][:len(lines[2])/2]
+				return lines
+			},
+			wantCount: 2,
+			wantErr:   "line 3",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			lines, lastHash := writeTrail(t, path, 4)
+			lines = tt.tamper(t, lines)
+			if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			count, hash, err := Verify(func(fn func(Record) bool) error { return ScanFile(path, fn) })
+			if count != tt.wantCount {
+				t.Errorf("verified %d records, want %d", count, tt.wantCount)
+			}
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("error %v, want one containing %q", err, tt.wantErr)
+			}
+			if tt.wantErr == "" && (hash != lastHash) != tt.wantLastChanged {
+				t.Errorf("last hash changed = %v, want %v", hash != lastHash, tt.wantLastChanged)
+			}
+		})
+	}
+}
+
+func TestFileSinkRepairsTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		// tear changes the end of a file holding three complete records
+		tear      func(data []byte) []byte
+		wantCount int
+	}{
+		{
+			name:      "partial record",
+			tear:      func(data []byte) []byte { return append(data, `{"seq":4,"time":"2026-01-01T09:`...) },
+			wantCount: 3,
+		},
+		{
+			name:      "complete record without its newline",
+			tear:      func(data []byte) []byte { return data[:len(data)-1] },
+			wantCount: 3,
+		},
+		{
+			name:      "intact file",
+			tear:      func(data []byte) []byte { return data },
+			wantCount: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			writeTrail(t, path, 3)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, tt.tear(data), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			// Reopening repairs the file and the chain continues after the last complete record
+			sink, err := NewFileSink(path, logrus.New())
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			trail, err := New(sink, logrus.New())
+			if err != nil {
+				t.Fatalf("continue the chain: %v", err)
+			}
+			record, err := trail.Append(Record{Actor: "admin-1", Action: ActionDoctorDelete, Outcome: OutcomeSuccess})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record.Seq != uint64(tt.wantCount+1) {
+				t.Errorf("next record is %d, want %d", record.Seq, tt.wantCount+1)
+			}
+			count, _, err := Verify(sink.Scan)
+			if err != nil || count != tt.wantCount+1 {
+				t.Errorf("verified %d records with error %v, want %d", count, err, tt.wantCount+1)
+			}
+			trail.Close()
+		})
+	}
+}
+
+// failingSink fails the appends while fail is set
+type failingSink struct {
+	*FileSink
+	fail bool
+}
+
+func (s *failingSink) Append(record Record) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.FileSink.Append(record)
+}
+
+func TestTrailFailedAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	file, err := NewFileSink(path, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := &failingSink{FileSink: file}
+	trail, err := New(sink, logrus.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trail.Close()
+	record := Record{Actor: "admin-1", Action: ActionDoctorDelete, Outcome: OutcomeSuccess}
+	if _, err := trail.Append(record); err != nil {
+		t.Fatal(err)
+	}
+	sink.fail = true
+	if _, err := trail.Append(record); err == nil {
+		t.Fatal("append to a failing sink succeeded")
+	}
+
+	// The failed record is not part of the chain, the next one takes its place
+	sink.fail = false
+	stored, err := trail.Append(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Seq != 2 {
+		t.Errorf("record after the failure is %d, want 2", stored.Seq)
+	}
+	if count, _, err := Verify(file.Scan); err != nil || count != 2 {
+		t.Errorf("verified %d records with error %v, want 2", count, err)
+	}
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Load balancing policies of an upstream with several replicas
+const (
+	BalancePickFirst    = "pick_first"
+	BalanceRoundRobin   = "round_robin"
+	BalanceLeastRequest = "least_request"
+)
+
+// ValidateBalancing checks the replica and balancing settings of an upstream
+func (u UpstreamTarget) ValidateBalancing(section string) error {
+	var errs []error
+	if u.Target != "" && len(u.Addresses) > 0 {
+		errs = append(errs, fmt.Errorf("%s: set either target or addresses", section))
+	}
+	for _, address := range u.Addresses {
+		if address == "" || strings.Contains(address, "/") {
+			errs = append(errs, fmt.Errorf("%s.addresses: %q is not a host:port address", section, address))
+		}
+	}
+	switch u.Balancer {
+	case "", BalancePickFirst, BalanceRoundRobin, BalanceLeastRequest:
+	default:
+		errs = append(errs, fmt.Errorf("%s.balancer: unknown policy %q, use pick_first, round_robin or least_request", section, u.Balancer))
+	}
+	return errors.Join(errs...)
+}
+
+// setAddress applies an address from the environment or a flag, which
+// replaces the configured ones. A comma separated value is a replica list.
+func (u *UpstreamTarget) setAddress(value string) {
+	u.Target, u.Addresses = "", nil
+	if !strings.Contains(value, ",") {
+		u.Target = value
+		return
+	}
+	for _, address := range strings.Split(value, ",") {
+		u.Addresses = append(u.Addresses, strings.TrimSpace(address))
+	}
+}
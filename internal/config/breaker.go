@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BreakerConfig decides when calls to an upstream stop being sent
+type BreakerConfig struct {
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// Window is the rolling period the failure and slow call rates are measured over
+	Window time.Duration `json:"window" yaml:"window"`
+	// MinRequests is how many calls the window needs before the breaker can open
+	MinRequests int `json:"min_requests" yaml:"min_requests"`
+	// FailureRate between 0 and 1 opens the breaker
+	FailureRate float64 `json:"failure_rate" yaml:"failure_rate"`
+	// Calls slower than SlowCallDuration are slow, SlowCallRate of them opens
+	// the breaker. A rate of 0 disables the latency threshold.
+	SlowCallDuration time.Duration `json:"slow_call_duration" yaml:"slow_call_duration"`
+	SlowCallRate     float64       `json:"slow_call_rate" yaml:"slow_call_rate"`
+	// OpenFor is how long calls are rejected before trial calls are let through
+	OpenFor time.Duration `json:"open_for" yaml:"open_for"`
+	// HalfOpenRequests trial calls must all succeed to close the breaker again
+	HalfOpenRequests int `json:"half_open_requests" yaml:"half_open_requests"`
+}
+
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Window:           30 * time.Second,
+		MinRequests:      10,
+		FailureRate:      0.5,
+		SlowCallDuration: 5 * time.Second,
+		SlowCallRate:     0.8,
+		OpenFor:          15 * time.Second,
+		HalfOpenRequests: 3,
+	}
+}
+
+func (b BreakerConfig) Validate(section string) error {
+	if b.Disabled {
+		return nil
+	}
+	var errs []error
+	if b.Window <= 0 || b.OpenFor <= 0 {
+		errs = append(errs, fmt.Errorf("%s: window and open_for must be positive", section))
+	}
+	if b.MinRequests < 1 || b.HalfOpenRequests < 1 {
+		errs = append(errs, fmt.Errorf("%s: min_requests and half_open_requests must be at least 1", section))
+	}
+	if b.FailureRate <= 0 || b.FailureRate > 1 || b.SlowCallRate < 0 || b.SlowCallRate > 1 {
+		errs = append(errs, fmt.Errorf("%s: failure_rate must be in (0, 1] and slow_call_rate in [0, 1]", section))
+	}
+	if b.SlowCallRate > 0 && b.SlowCallDuration <= 0 {
+		errs = append(errs, fmt.Errorf("%s: slow_call_rate needs a positive slow_call_duration", section))
+	}
+	return errors.Join(errs...)
+}
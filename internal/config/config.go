@@ -0,0 +1,574 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/logs"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
+)
+
+// devJWTSecret is a public development key, it is only used with -dev or
+// GATEWAY_ENV=dev when no JWT key is configured
+const devJWTSecret = "my_secret_key"
+
+// Config is every setting the gateway reads at startup
+type Config struct {
+	Server     ServerConfig     `json:"server" yaml:"server"`
+	Upstreams  UpstreamConfig   `json:"upstreams" yaml:"upstreams"`
+	JWT        JWTConfig        `json:"jwt" yaml:"jwt"`
+	Security   SecurityConfig   `json:"security" yaml:"security"`
+	Google     GoogleConfig     `json:"google" yaml:"google"`
+	DialogFlow DialogFlowConfig `json:"dialogflow" yaml:"dialogflow"`
+	Retries    RetryConfig      `json:"retries" yaml:"retries"`
+	Tracing    TracingConfig    `json:"tracing" yaml:"tracing"`
+	Audit      AuditConfig      `json:"audit" yaml:"audit"`
+
+	// The sections below are applied again when the config is reloaded
+	CORS        di.CORSPolicy               `json:"cors" yaml:"cors"`
+	RateLimits  RateLimitConfig             `json:"rate_limits" yaml:"rate_limits"`
+	Log         LogConfig                   `json:"log" yaml:"log"`
+	Health      HealthConfig                `json:"health" yaml:"health"`
+	Deadlines   DeadlineConfig              `json:"deadlines" yaml:"deadlines"`
+	Permissions middleware.PermissionConfig `json:"permissions" yaml:"permissions"`
+
+	// file is the YAML file the config was read from, if any
+	file string
+	// dev allows development fallbacks such as the built-in JWT secret
+	dev bool
+}
+
+type ServerConfig struct {
+	// Addr is the listen address, for example ":8080"
+	Addr string `json:"addr" yaml:"addr"`
+	// TrustForwardedFor takes client IPs from the last X-Forwarded-For entry, only safe behind a proxy that appends it
+	TrustForwardedFor bool `json:"trust_forwarded_for" yaml:"trust_forwarded_for"`
+	// ConfigPollInterval is how often the config file is checked for changes, 0 disables polling
+	ConfigPollInterval time.Duration `json:"config_poll_interval" yaml:"config_poll_interval"`
+
+	ReadTimeout       time.Duration `json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout time.Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      time.Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       time.Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	MaxHeaderBytes    int           `json:"max_header_bytes" yaml:"max_header_bytes"`
+	// ShutdownTimeout is how long in-flight requests and chats get to finish on SIGTERM
+	ShutdownTimeout time.Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	TLS TLSConfig `json:"tls" yaml:"tls"`
+}
+
+// UpstreamConfig holds the gRPC targets of the backend services
+type UpstreamConfig struct {
+	User        UpstreamTarget `json:"user" yaml:"user"`
+	Appointment UpstreamTarget `json:"appointment" yaml:"appointment"`
+	Payment     UpstreamTarget `json:"payment" yaml:"payment"`
+}
+
+type JWTConfig struct {
+	// Secret is the single HS256 key used when Keys is empty
+	Secret      string                 `json:"secret" yaml:"secret"`
+	Keys        []middleware.KeyConfig `json:"keys" yaml:"keys"`
+	ActiveKeyID string                 `json:"active_kid" yaml:"active_kid"`
+	Issuer      string                 `json:"issuer" yaml:"issuer"`
+	// TokenSources is the order access tokens are looked up in: header, cookie, query
+	TokenSources []string `json:"token_sources" yaml:"token_sources"`
+	QueryParam   string   `json:"query_param" yaml:"query_param"`
+}
+
+type SecurityConfig struct {
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer string `json:"mfa_issuer" yaml:"mfa_issuer"`
+}
+
+// GoogleConfig is the OAuth client doctors link Google Calendar with
+type GoogleConfig struct {
+	ClientID     string `json:"client_id" yaml:"client_id"`
+	ClientSecret string `json:"client_secret" yaml:"client_secret"`
+	RedirectURL  string `json:"redirect_url" yaml:"redirect_url"`
+	// StateSecret signs the OAuth state cookie, it must be shared by all instances
+	StateSecret string `json:"state_secret" yaml:"state_secret"`
+}
+
+// RateLimitConfig holds the sign-in throttling limits
+type RateLimitConfig struct {
+	LoginEmail middleware.LoginLimits `json:"login_email" yaml:"login_email"`
+	LoginIP    middleware.LoginLimits `json:"login_ip" yaml:"login_ip"`
+}
+
+type LogConfig struct {
+	// Level is a logrus level: panic, fatal, error, warn, info, debug or trace
+	Level string `json:"level" yaml:"level"`
+	// Redact masks patient data and credentials in every log entry
+	Redact logs.RedactConfig `json:"redact" yaml:"redact"`
+}
+
+// AuditConfig is where the audit trail of admin and clinical actions is kept
+type AuditConfig struct {
+	// Sink is file or none
+	Sink string `json:"sink" yaml:"sink"`
+	// File is the append-only audit file of the file sink, one per gateway instance
+	File string `json:"file" yaml:"file"`
+}
+
+// Audit sinks
+const (
+	AuditNone = "none"
+	AuditFile = "file"
+)
+
+type DialogFlowConfig struct {
+	// CredentialsJSON is a service account key, CredentialsFile a path to one
+	CredentialsJSON string `json:"credentials_json" yaml:"credentials_json"`
+	CredentialsFile string `json:"credentials_file" yaml:"credentials_file"`
+	ProjectID       string `json:"project_id" yaml:"project_id"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:               ":8080",
+			ConfigPollInterval: 10 * time.Second,
+			ReadTimeout:        15 * time.Second,
+			ReadHeaderTimeout:  5 * time.Second,
+			WriteTimeout:       30 * time.Second,
+			IdleTimeout:        2 * time.Minute,
+			MaxHeaderBytes:     1 << 20,
+			ShutdownTimeout:    30 * time.Second,
+			TLS:                TLSConfig{MinVersion: "1.2", ReloadInterval: time.Minute},
+		},
+		JWT: JWTConfig{
+			TokenSources: []string{string(middleware.SourceHeader), string(middleware.SourceCookie)},
+			QueryParam:   "access_token",
+		},
+		Upstreams: UpstreamConfig{
+			User:        defaultUpstream(),
+			Appointment: defaultUpstream(),
+			Payment:     defaultUpstream(),
+		},
+		Security: SecurityConfig{MFAIssuer: "HospConnect"},
+		Google: GoogleConfig{
+			RedirectURL: "https://hilofy.online/api/v1/doctor/auth/callback",
+		},
+		DialogFlow: DialogFlowConfig{ProjectID: "docto-sheduler"},
+		Retries: RetryConfig{
+			MaxAttempts:       3,
+			InitialBackoff:    100 * time.Millisecond,
+			MaxBackoff:        time.Second,
+			BackoffMultiplier: 2,
+			RetryableCodes:    []string{"UNAVAILABLE"},
+			Methods:           append([]string(nil), idempotentRPCs...),
+		},
+		Tracing: TracingConfig{
+			Exporter:    ExporterNone,
+			Protocol:    OTLPGRPC,
+			ServiceName: "hosp-connect-api-gateway",
+			SampleRatio: 1,
+		},
+		Audit: AuditConfig{Sink: AuditFile, File: "logs/audit.log"},
+		CORS:  di.DefaultCORSPolicy(),
+		RateLimits: RateLimitConfig{
+			LoginEmail: middleware.DefaultEmailLimits(),
+			LoginIP:    middleware.DefaultIPLimits(),
+		},
+		Log: LogConfig{Level: "info", Redact: logs.DefaultRedactConfig()},
+		Health: HealthConfig{
+			CriticalUpstreams: []string{"user", "appointment", "payment"},
+			CheckInterval:     10 * time.Second,
+			CheckTimeout:      2 * time.Second,
+		},
+		Deadlines:   DeadlineConfig{Default: 15 * time.Second},
+		Permissions: middleware.DefaultPermissionConfig(),
+	}
+}
+
+func defaultUpstream() UpstreamTarget {
+	return UpstreamTarget{
+		TLS:     UpstreamTLSConfig{ReloadInterval: time.Minute},
+		Breaker: DefaultBreakerConfig(),
+	}
+}
+
+// Load builds the configuration from defaults, the optional YAML file given by
+// -config or GATEWAY_CONFIG, environment variables and flags, in that order of
+// precedence, and validates the result
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("api-gateway", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("GATEWAY_CONFIG"), "path to a YAML config file")
+	addr := flags.String("addr", "", "listen address, overrides SERVER_PORT")
+	userServer := flags.String("user-grpc-server", "", "user service address, overrides USER_GRPC_SERVER")
+	apptServer := flags.String("appt-grpc-server", "", "appointment service address, overrides APPT_GRPC_SERVER")
+	paymentServer := flags.String("payment-grpc-server", "", "payment service address, overrides PAYMENT_GRPC_SERVER")
+	dev := flags.Bool("dev", os.Getenv("GATEWAY_ENV") == "dev", "development mode, allows the built-in JWT secret (GATEWAY_ENV=dev)")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := LoadEnv(); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	cfg.dev = *dev
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, err
+		}
+		cfg.file = *path
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "addr":
+			cfg.Server.Addr = *addr
+		case "user-grpc-server":
+			cfg.Upstreams.User.setAddress(*userServer)
+		case "appt-grpc-server":
+			cfg.Upstreams.Appointment.setAddress(*apptServer)
+		case "payment-grpc-server":
+			cfg.Upstreams.Payment.setAddress(*paymentServer)
+		}
+	})
+
+	cfg.normalize()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %v", err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && err != io.EOF {
+		return fmt.Errorf("parse config file %s: %v", path, err)
+	}
+	return nil
+}
+
+// loadEnv applies the environment variables the gateway has always used
+func (c *Config) loadEnv() error {
+	setString(&c.Server.Addr, "SERVER_PORT")
+	setString(&c.Server.TLS.CertFile, "TLS_CERT_FILE")
+	setString(&c.Server.TLS.KeyFile, "TLS_KEY_FILE")
+	setString(&c.Server.TLS.RedirectAddr, "TLS_REDIRECT_ADDR")
+	if value, ok := os.LookupEnv("TRUST_FORWARDED_FOR"); ok {
+		c.Server.TrustForwardedFor = value == "true"
+	}
+
+	for _, upstream := range []struct {
+		target *UpstreamTarget
+		env    string
+	}{
+		{&c.Upstreams.User, "USER_GRPC_SERVER"},
+		{&c.Upstreams.Appointment, "APPT_GRPC_SERVER"},
+		{&c.Upstreams.Payment, "PAYMENT_GRPC_SERVER"},
+	} {
+		if value := os.Getenv(upstream.env); value != "" {
+			upstream.target.setAddress(value)
+		}
+	}
+
+	setString(&c.JWT.Secret, "JWT_SECRET")
+	if raw := os.Getenv("JWT_KEYS"); raw != "" {
+		var keys []middleware.KeyConfig
+		if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+			return fmt.Errorf("invalid JWT_KEYS: %v", err)
+		}
+		c.JWT.Keys = keys
+	}
+	setString(&c.JWT.ActiveKeyID, "JWT_ACTIVE_KID")
+	setString(&c.JWT.Issuer, "JWT_ISSUER")
+	if raw := os.Getenv("JWT_TOKEN_SOURCES"); raw != "" {
+		c.JWT.TokenSources = strings.Split(raw, ",")
+	}
+	setString(&c.JWT.QueryParam, "JWT_QUERY_PARAM")
+
+	setString(&c.Security.MFAIssuer, "MFA_ISSUER")
+
+	setString(&c.Google.ClientID, "CLIENT_ID")
+	setString(&c.Google.ClientSecret, "CLIENT_SECRET")
+	setString(&c.Google.RedirectURL, "GOOGLE_REDIRECT_URL")
+	setString(&c.Google.StateSecret, "OAUTH_STATE_SECRET")
+
+	setString(&c.DialogFlow.CredentialsJSON, "DIALOG_FLOW_CREDENTIALS_JSON")
+	setString(&c.DialogFlow.CredentialsFile, "DIALOG_FLOW_CREDENTIALS_FILE")
+	setString(&c.DialogFlow.ProjectID, "DIALOG_FLOW_PROJECT_ID")
+
+	if raw := os.Getenv("CORS_ALLOWED_ORIGINS"); raw != "" {
+		c.setCORSOrigins(strings.Split(raw, ","))
+	}
+	setString(&c.Log.Level, "LOG_LEVEL")
+	setString(&c.Tracing.Exporter, "TRACING_EXPORTER")
+	setString(&c.Tracing.ServiceName, "OTEL_SERVICE_NAME")
+	setString(&c.Audit.File, "AUDIT_FILE")
+	return nil
+}
+
+// setCORSOrigins replaces the allowed origins of every CORS rule
+func (c *Config) setCORSOrigins(origins []string) {
+	for i := range c.CORS.Rules {
+		c.CORS.Rules[i].AllowedOrigins = append([]string(nil), origins...)
+	}
+}
+
+func setString(field *string, name string) {
+	if value := os.Getenv(name); value != "" {
+		*field = value
+	}
+}
+
+func (c *Config) normalize() {
+	// SERVER_PORT has been given both as ":8080" and as "8080"
+	if c.Server.Addr != "" && !strings.Contains(c.Server.Addr, ":") {
+		c.Server.Addr = ":" + c.Server.Addr
+	}
+	for i, source := range c.JWT.TokenSources {
+		c.JWT.TokenSources[i] = strings.TrimSpace(source)
+	}
+	for _, rule := range c.CORS.Rules {
+		for i, origin := range rule.AllowedOrigins {
+			rule.AllowedOrigins[i] = strings.TrimSpace(origin)
+		}
+	}
+	if len(c.JWT.Keys) == 0 {
+		secret := c.JWT.Secret
+		if secret == "" && c.dev {
+			log.Println("JWT_SECRET is not set, development mode falls back to the built-in development secret")
+			secret = devJWTSecret
+		}
+		if secret != "" {
+			c.JWT.Keys = []middleware.KeyConfig{{ID: middleware.LegacyKeyID, Algorithm: "HS256", Secret: secret}}
+		}
+	}
+	if c.JWT.ActiveKeyID == "" && len(c.JWT.Keys) > 0 {
+		c.JWT.ActiveKeyID = c.JWT.Keys[0].ID
+	}
+}
+
+// Validate reports every problem in the configuration at once
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr (SERVER_PORT) is required"))
+	}
+	for _, upstream := range []struct {
+		name, env string
+		target    UpstreamTarget
+	}{
+		{"upstreams.user", "USER_GRPC_SERVER", c.Upstreams.User},
+		{"upstreams.appointment", "APPT_GRPC_SERVER", c.Upstreams.Appointment},
+		{"upstreams.payment", "PAYMENT_GRPC_SERVER", c.Upstreams.Payment},
+	} {
+		if upstream.target.Target == "" && len(upstream.target.Addresses) == 0 {
+			errs = append(errs, fmt.Errorf("%s.target or addresses (%s) is required", upstream.name, upstream.env))
+		}
+		if err := upstream.target.ValidateBalancing(upstream.name); err != nil {
+			errs = append(errs, err)
+		}
+		if err := upstream.target.TLS.Validate(upstream.name + ".tls"); err != nil {
+			errs = append(errs, err)
+		}
+		if err := upstream.target.Breaker.Validate(upstream.name + ".breaker"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(c.JWT.Keys) == 0 {
+		errs = append(errs, errors.New("jwt.secret (JWT_SECRET) or jwt.keys (JWT_KEYS) is required, the built-in development secret needs -dev or GATEWAY_ENV=dev"))
+	} else if _, err := c.JWT.KeyManager(); err != nil {
+		errs = append(errs, fmt.Errorf("jwt: %v", err))
+	}
+	for _, key := range c.JWT.Keys {
+		if key.Algorithm == "HS256" {
+			continue
+		}
+		// The discovery document publishes the issuer and the jwks_uri under it
+		if u, err := url.Parse(c.JWT.Issuer); err != nil || !u.IsAbs() {
+			errs = append(errs, fmt.Errorf("jwt.issuer (JWT_ISSUER) must be an absolute URL when asymmetric keys are published, got %q", c.JWT.Issuer))
+		}
+		break
+	}
+	if len(c.JWT.TokenSources) == 0 {
+		errs = append(errs, errors.New("jwt.token_sources must not be empty"))
+	}
+	for _, source := range c.JWT.TokenSources {
+		switch middleware.TokenSource(source) {
+		case middleware.SourceHeader, middleware.SourceCookie, middleware.SourceQuery:
+		default:
+			errs = append(errs, fmt.Errorf("jwt.token_sources: unknown source %q", source))
+		}
+	}
+
+	if err := c.Permissions.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if (c.Google.ClientID == "") != (c.Google.ClientSecret == "") {
+		errs = append(errs, errors.New("google.client_id (CLIENT_ID) and google.client_secret (CLIENT_SECRET) must be set together"))
+	}
+	// Without a shared secret every instance signs the state with its own random key
+	if c.Google.ClientID != "" && c.Google.StateSecret == "" && !c.dev {
+		errs = append(errs, errors.New("google.state_secret (OAUTH_STATE_SECRET) is required with google.client_id, a random per-process key needs -dev or GATEWAY_ENV=dev"))
+	}
+	if u, err := url.Parse(c.Google.RedirectURL); err != nil || !u.IsAbs() {
+		errs = append(errs, fmt.Errorf("google.redirect_url (GOOGLE_REDIRECT_URL) must be an absolute URL, got %q", c.Google.RedirectURL))
+	}
+
+	if c.DialogFlow.CredentialsJSON != "" && c.DialogFlow.CredentialsFile != "" {
+		errs = append(errs, errors.New("dialogflow: set credentials_json or credentials_file, not both"))
+	}
+	if _, err := c.DialogFlow.Credentials(); err != nil {
+		errs = append(errs, fmt.Errorf("dialogflow: %v", err))
+	}
+	if c.DialogFlow.ProjectID == "" {
+		errs = append(errs, errors.New("dialogflow.project_id is required"))
+	}
+
+	if err := c.CORS.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, limit := range []struct {
+		name   string
+		limits middleware.LoginLimits
+	}{
+		{"rate_limits.login_email", c.RateLimits.LoginEmail},
+		{"rate_limits.login_ip", c.RateLimits.LoginIP},
+	} {
+		if limit.limits.FreeAttempts < 0 || limit.limits.LockoutAfter <= limit.limits.FreeAttempts {
+			errs = append(errs, fmt.Errorf("%s: lockout_after must be greater than free_attempts", limit.name))
+		}
+		if limit.limits.BaseDelay <= 0 || limit.limits.MaxDelay < limit.limits.BaseDelay || limit.limits.LockoutFor <= 0 || limit.limits.Window <= 0 {
+			errs = append(errs, fmt.Errorf("%s: delays and window must be positive and max_delay at least base_delay", limit.name))
+		}
+	}
+	if _, err := logrus.ParseLevel(c.Log.Level); err != nil {
+		errs = append(errs, fmt.Errorf("log.level (LOG_LEVEL): %v", err))
+	}
+	if err := c.Log.Redact.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Health.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Deadlines.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Retries.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	switch c.Audit.Sink {
+	case AuditNone:
+	case AuditFile:
+		if c.Audit.File == "" {
+			errs = append(errs, errors.New("audit.file (AUDIT_FILE) is required for the file sink"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("audit.sink must be file or none, got %q", c.Audit.Sink))
+	}
+	if c.Server.ConfigPollInterval < 0 {
+		errs = append(errs, errors.New("server.config_poll_interval must not be negative"))
+	}
+	if c.Server.ReadTimeout <= 0 || c.Server.ReadHeaderTimeout <= 0 || c.Server.WriteTimeout <= 0 || c.Server.IdleTimeout <= 0 {
+		errs = append(errs, errors.New("server read, read header, write and idle timeouts must be positive"))
+	}
+	if c.Server.MaxHeaderBytes <= 0 {
+		errs = append(errs, errors.New("server.max_header_bytes must be positive"))
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("server.shutdown_timeout must be positive"))
+	}
+	if err := c.Server.TLS.Validate("server.tls"); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// File returns the YAML file the config was read from, or "" when there is none
+func (c *Config) File() string {
+	return c.file
+}
+
+const redacted = "[redacted]"
+
+// Redacted returns a copy that is safe to show, with every secret masked
+func (c *Config) Redacted() *Config {
+	out := *c
+	mask := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return redacted
+	}
+	out.JWT.Secret = mask(c.JWT.Secret)
+	out.JWT.Keys = make([]middleware.KeyConfig, len(c.JWT.Keys))
+	for i, key := range c.JWT.Keys {
+		key.Secret = mask(key.Secret)
+		out.JWT.Keys[i] = key
+	}
+	out.Google.ClientSecret = mask(c.Google.ClientSecret)
+	out.Google.StateSecret = mask(c.Google.StateSecret)
+	out.DialogFlow.CredentialsJSON = mask(c.DialogFlow.CredentialsJSON)
+	return &out
+}
+
+// KeyManager parses the configured signing keys
+func (j JWTConfig) KeyManager() (*middleware.KeyManager, error) {
+	manager, err := middleware.NewKeyManagerFromConfig(j.Keys, j.ActiveKeyID)
+	if err != nil {
+		return nil, err
+	}
+	manager.Issuer = j.Issuer
+	return manager, nil
+}
+
+// Sources returns the token sources in lookup order
+func (j JWTConfig) Sources() []middleware.TokenSource {
+	sources := make([]middleware.TokenSource, 0, len(j.TokenSources))
+	for _, source := range j.TokenSources {
+		sources = append(sources, middleware.TokenSource(source))
+	}
+	return sources
+}
+
+// Credentials returns the service account key, or nil when the help desk is not configured
+func (d DialogFlowConfig) Credentials() ([]byte, error) {
+	data := []byte(d.CredentialsJSON)
+	if d.CredentialsFile != "" {
+		var err error
+		if data, err = ioutil.ReadFile(d.CredentialsFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if !json.Valid(data) {
+		return nil, errors.New("credentials are not valid JSON")
+	}
+	return data, nil
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
+)
+
+// gatewayEnv lists the variables Load reads, cleared so the environment of
+// the test run does not leak in
+var gatewayEnv = []string{
+	"GATEWAY_CONFIG", "GATEWAY_ENV", "SERVER_PORT", "USER_GRPC_SERVER", "APPT_GRPC_SERVER", "PAYMENT_GRPC_SERVER",
+	"JWT_SECRET", "JWT_KEYS", "JWT_ACTIVE_KID", "JWT_ISSUER", "JWT_TOKEN_SOURCES", "LOG_LEVEL",
+	"CLIENT_ID", "CLIENT_SECRET", "OAUTH_STATE_SECRET", "TRUST_FORWARDED_FOR",
+}
+
+const testConfigFile = `server:
+  addr: ":7000"
+upstreams:
+  user: file-user:50051
+  appointment: file-appt:50052
+  payment: file-payment:50053
+jwt:
+  secret: file-secret
+log:
+  level: debug
+`
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      bool
+		env       map[string]string
+		args      []string
+		wantAddr  string
+		wantUser  UpstreamTarget
+		wantLevel string
+	}{
+		{
+			name:      "defaults and environment",
+			env:       map[string]string{"USER_GRPC_SERVER": "env-user:50051", "APPT_GRPC_SERVER": "a:1", "PAYMENT_GRPC_SERVER": "p:1", "JWT_SECRET": "env-secret"},
+			wantAddr:  ":8080",
+			wantUser:  UpstreamTarget{Target: "env-user:50051"},
+			wantLevel: "info",
+		},
+		{
+			name:      "file over defaults",
+			file:      true,
+			wantAddr:  ":7000",
+			wantUser:  UpstreamTarget{Target: "file-user:50051"},
+			wantLevel: "debug",
+		},
+		{
+			name:      "environment over file",
+			file:      true,
+			env:       map[string]string{"SERVER_PORT": "9000", "USER_GRPC_SERVER": "env-user:50051", "LOG_LEVEL": "warn"},
+			wantAddr:  ":9000",
+			wantUser:  UpstreamTarget{Target: "env-user:50051"},
+			wantLevel: "warn",
+		},
+		{
+			name:      "flags over environment",
+			file:      true,
+			env:       map[string]string{"SERVER_PORT": "9000", "USER_GRPC_SERVER": "env-user:50051"},
+			args:      []string{"-addr", ":9100", "-user-grpc-server", "user-0:50051, user-1:50051"},
+			wantAddr:  ":9100",
+			wantUser:  UpstreamTarget{Addresses: []string{"user-0:50051", "user-1:50051"}},
+			wantLevel: "debug",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range gatewayEnv {
+				t.Setenv(name, "")
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file {
+				path := filepath.Join(t.TempDir(), "gateway.yaml")
+				if err := os.WriteFile(path, []byte(testConfigFile), 0o600); err != nil {
+					t.Fatal(err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+
+			cfg, err := Load(args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Server.Addr != tt.wantAddr {
+				t.Errorf("server.addr = %q, want %q", cfg.Server.Addr, tt.wantAddr)
+			}
+			user := cfg.Upstreams.User
+			if user.Target != tt.wantUser.Target || !reflect.DeepEqual(user.Addresses, tt.wantUser.Addresses) {
+				t.Errorf("upstreams.user = %q %q, want %q %q", user.Target, user.Addresses, tt.wantUser.Target, tt.wantUser.Addresses)
+			}
+			if cfg.Log.Level != tt.wantLevel {
+				t.Errorf("log.level = %q, want %q", cfg.Log.Level, tt.wantLevel)
+			}
+		})
+	}
+}
+
+func TestLoadRequiresJWTKeyOutsideDev(t *testing.T) {
+	for _, name := range gatewayEnv {
+		t.Setenv(name, "")
+	}
+	t.Setenv("USER_GRPC_SERVER", "u:1")
+	t.Setenv("APPT_GRPC_SERVER", "a:1")
+	t.Setenv("PAYMENT_GRPC_SERVER", "p:1")
+
+	if _, err := Load(nil); err == nil || !strings.Contains(err.Error(), "jwt.secret") {
+		t.Errorf("Load without a key: %v, want a jwt.secret error", err)
+	}
+	cfg, err := Load([]string{"-dev"})
+	if err != nil {
+		t.Fatalf("Load with -dev: %v", err)
+	}
+	if len(cfg.JWT.Keys) != 1 || cfg.JWT.Keys[0].Secret != devJWTSecret {
+		t.Errorf("-dev keys = %+v, want the development secret", cfg.JWT.Keys)
+	}
+}
+
+// validConfig is the default configuration with the settings it has no
+// default for
+func validConfig() *Config {
+	cfg := Default()
+	cfg.Upstreams.User.Target = "user:50051"
+	cfg.Upstreams.Appointment.Target = "appointment:50052"
+	cfg.Upstreams.Payment.Target = "payment:50053"
+	cfg.JWT.Keys = []middleware.KeyConfig{{ID: "test", Algorithm: "HS256", Secret: "test-secret"}}
+	cfg.JWT.ActiveKeyID = "test"
+	return cfg
+}
+
+// writeECKey writes a new P-256 private key in PEM and returns its path
+func writeECKey(t *testing.T) string {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(t *testing.T, c *Config)
+		// wantErrs are parts of the error, none means the config is valid
+		wantErrs []string
+	}{
+		{name: "valid", edit: func(t *testing.T, c *Config) {}},
+		{
+			name:     "missing upstream",
+			edit:     func(t *testing.T, c *Config) { c.Upstreams.Payment.Target = "" },
+			wantErrs: []string{"upstreams.payment.target or addresses (PAYMENT_GRPC_SERVER) is required"},
+		},
+		{
+			name: "every problem at once",
+			edit: func(t *testing.T, c *Config) {
+				c.Server.Addr = ""
+				c.Upstreams.Appointment.Balancer = "random"
+				c.JWT.TokenSources = []string{"header", "body"}
+				c.Log.Level = "loud"
+			},
+			wantErrs: []string{"server.addr", "upstreams.appointment.balancer", `unknown source "body"`, "log.level"},
+		},
+		{
+			name:     "no JWT key",
+			edit:     func(t *testing.T, c *Config) { c.JWT.Keys = nil },
+			wantErrs: []string{"jwt.secret (JWT_SECRET) or jwt.keys (JWT_KEYS) is required"},
+		},
+		{
+			name: "asymmetric key without an issuer",
+			edit: func(t *testing.T, c *Config) {
+				c.JWT.Keys = []middleware.KeyConfig{{ID: "ec", Algorithm: "ES256", File: writeECKey(t)}}
+				c.JWT.ActiveKeyID = "ec"
+			},
+			wantErrs: []string{"jwt.issuer (JWT_ISSUER) must be an absolute URL"},
+		},
+		{
+			name: "asymmetric key with an issuer",
+			edit: func(t *testing.T, c *Config) {
+				c.JWT.Keys = []middleware.KeyConfig{{ID: "ec", Algorithm: "ES256", File: writeECKey(t)}}
+				c.JWT.ActiveKeyID = "ec"
+				c.JWT.Issuer = "https://hilofy.online"
+			},
+		},
+		{
+			name: "Google OAuth without a state secret",
+			edit: func(t *testing.T, c *Config) {
+				c.Google.ClientID, c.Google.ClientSecret = "client", "secret"
+			},
+			wantErrs: []string{"google.state_secret (OAUTH_STATE_SECRET) is required"},
+		},
+		{
+			name: "Google OAuth without a state secret in dev mode",
+			edit: func(t *testing.T, c *Config) {
+				c.Google.ClientID, c.Google.ClientSecret = "client", "secret"
+				c.dev = true
+			},
+		},
+		{
+			name:     "Google client id without its secret",
+			edit:     func(t *testing.T, c *Config) { c.Google.ClientID, c.Google.StateSecret = "client", "state" },
+			wantErrs: []string{"must be set together"},
+		},
+		{
+			name: "lockout before the free attempts run out",
+			edit: func(t *testing.T, c *Config) {
+				c.RateLimits.LoginEmail.LockoutAfter = c.RateLimits.LoginEmail.FreeAttempts
+			},
+			wantErrs: []string{"rate_limits.login_email: lockout_after must be greater than free_attempts"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.edit(t, cfg)
+			err := cfg.Validate()
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.wantErrs)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
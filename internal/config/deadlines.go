@@ -0,0 +1,150 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// DeadlineConfig bounds how long a request and each upstream call may take
+type DeadlineConfig struct {
+	// Default applies to requests without a route entry, 0 disables it
+	Default time.Duration `json:"default" yaml:"default"`
+	// Routes maps a mux path template, for example /api/v1/patient/confirm-appointment, to its deadline
+	Routes map[string]time.Duration `json:"routes" yaml:"routes"`
+	// RPCs maps a full method name, for example /appointment.AppointmentService/ConfirmAppointment,
+	// to its deadline. It can only shorten the deadline of the request.
+	RPCs map[string]time.Duration `json:"rpcs" yaml:"rpcs"`
+}
+
+func (d DeadlineConfig) Validate() error {
+	var errs []error
+	if d.Default < 0 {
+		errs = append(errs, errors.New("deadlines.default must not be negative"))
+	}
+	for _, route := range sortedKeys(d.Routes) {
+		if !strings.HasPrefix(route, "/") {
+			errs = append(errs, fmt.Errorf("deadlines.routes: %q is not a path template", route))
+		}
+		if d.Routes[route] <= 0 {
+			errs = append(errs, fmt.Errorf("deadlines.routes: %s must be positive", route))
+		}
+	}
+	for _, method := range sortedKeys(d.RPCs) {
+		if !validMethodName(method) {
+			errs = append(errs, fmt.Errorf("deadlines.rpcs: %q is not a /package.Service/Method name", method))
+		}
+		if d.RPCs[method] <= 0 {
+			errs = append(errs, fmt.Errorf("deadlines.rpcs: %s must be positive", method))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func sortedKeys(m map[string]time.Duration) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func validMethodName(method string) bool {
+	service, name, ok := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+	return strings.HasPrefix(method, "/") && ok && strings.Contains(service, ".") && name != "" && !strings.Contains(name, "/")
+}
+
+// RetryConfig is the gRPC retry policy of the idempotent upstream calls
+type RetryConfig struct {
+	// MaxAttempts includes the first call, gRPC allows at most 5. 0 or 1 disables retries.
+	MaxAttempts       int           `json:"max_attempts" yaml:"max_attempts"`
+	InitialBackoff    time.Duration `json:"initial_backoff" yaml:"initial_backoff"`
+	MaxBackoff        time.Duration `json:"max_backoff" yaml:"max_backoff"`
+	BackoffMultiplier float64       `json:"backoff_multiplier" yaml:"backoff_multiplier"`
+	// RetryableCodes are gRPC status names such as UNAVAILABLE
+	RetryableCodes []string `json:"retryable_codes" yaml:"retryable_codes"`
+	// Methods are the full names of the RPCs that are safe to send twice.
+	// Every other RPC is sent exactly once.
+	Methods []string `json:"methods" yaml:"methods"`
+}
+
+// idempotentRPCs only read data, retrying them cannot book or charge twice
+var idempotentRPCs = []string{
+	"/admin.AdminService/ListDoctors",
+	"/admin.AdminService/ListPatients",
+	"/appointment.AppointmentService/CheckAvailability",
+	"/appointment.AppointmentService/CheckAvailabilityByDoctorId",
+	"/appointment.AppointmentService/GetAppointmentDetails",
+	"/appointment.AppointmentService/GetUpcomingAppointments",
+	"/appointment.AppointmentService/FetchStatisticsDetails",
+	"/appointment.AppointmentService/GetTotalAppointment",
+	"/doctor.DoctorService/GetProfile",
+	"/doctor.DoctorService/GetAccessToken",
+	"/doctor.DoctorService/GetAvailability",
+	"/doctor.DoctorService/CheckAvailabilityByDoctorId",
+	"/doctor.DoctorService/GetTotalDoctor",
+	"/patient.PatientService/GetProfile",
+	"/patient.PatientService/GetPrescription",
+	"/patient.PatientService/GetTotalPatient",
+	"/payment.PaymentService/GetTotalRevenue",
+}
+
+// nonIdempotentRPCs create bookings, payments or records and must never be
+// retried, a retry after a lost response would do it twice
+var nonIdempotentRPCs = []string{
+	"/admin.AdminService/AddDoctor",
+	"/admin.AdminService/AddPatient",
+	"/appointment.AppointmentService/ConfirmAppointment",
+	"/appointment.AppointmentService/CompletePayment",
+	"/appointment.AppointmentService/CancelAppointment",
+	"/appointment.AppointmentService/CreateRoomForVideoTreatment",
+	"/appointment.AppointmentService/AddSpecialization",
+	"/doctor.DoctorService/AddPrescription",
+	"/doctor.DoctorService/AddDoctor",
+	"/doctor.DoctorService/ConfirmSchedule",
+	"/patient.PatientService/SignUp",
+	"/patient.PatientService/AddPrescription",
+	"/payment.PaymentService/CreateRazorOrderId",
+	"/payment.PaymentService/CreateAppointmentFeePayment",
+	"/payment.PaymentService/PaymentCallback",
+}
+
+func (rc RetryConfig) Enabled() bool {
+	return rc.MaxAttempts > 1 && len(rc.Methods) > 0
+}
+
+func (rc RetryConfig) Validate() error {
+	var errs []error
+	if rc.MaxAttempts < 0 || rc.MaxAttempts > 5 {
+		errs = append(errs, errors.New("retries.max_attempts must be between 0 and 5"))
+	}
+	if !rc.Enabled() {
+		return errors.Join(errs...)
+	}
+	if rc.InitialBackoff <= 0 || rc.MaxBackoff < rc.InitialBackoff || rc.BackoffMultiplier <= 0 {
+		errs = append(errs, errors.New("retries: backoffs and multiplier must be positive and max_backoff at least initial_backoff"))
+	}
+	if len(rc.RetryableCodes) == 0 {
+		errs = append(errs, errors.New("retries.retryable_codes must not be empty"))
+	}
+	for _, name := range rc.RetryableCodes {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(`"` + name + `"`)); err != nil || code == codes.OK {
+			errs = append(errs, fmt.Errorf("retries.retryable_codes: unknown gRPC status %q", name))
+		}
+	}
+	for _, method := range rc.Methods {
+		if !validMethodName(method) {
+			errs = append(errs, fmt.Errorf("retries.methods: %q is not a /package.Service/Method name", method))
+		}
+		if contains(nonIdempotentRPCs, method) {
+			errs = append(errs, fmt.Errorf("retries.methods: %s is not idempotent and must not be retried", method))
+		}
+	}
+	return errors.Join(errs...)
+}
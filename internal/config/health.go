@@ -0,0 +1,41 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// upstreamNames are the upstreams critical_upstreams may refer to
+var upstreamNames = []string{"user", "appointment", "payment"}
+
+type HealthConfig struct {
+	// CriticalUpstreams must all be serving for /readyz to report ready
+	CriticalUpstreams []string `json:"critical_upstreams" yaml:"critical_upstreams"`
+	// CheckInterval is how often every upstream is probed
+	CheckInterval time.Duration `json:"check_interval" yaml:"check_interval"`
+	// CheckTimeout bounds a single probe
+	CheckTimeout time.Duration `json:"check_timeout" yaml:"check_timeout"`
+}
+
+func (h HealthConfig) Validate() error {
+	var errs []error
+	for _, name := range h.CriticalUpstreams {
+		if !contains(upstreamNames, name) {
+			errs = append(errs, fmt.Errorf("health.critical_upstreams: unknown upstream %q", name))
+		}
+	}
+	if h.CheckInterval <= 0 || h.CheckTimeout <= 0 {
+		errs = append(errs, errors.New("health.check_interval and health.check_timeout must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
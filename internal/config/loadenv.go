@@ -1,13 +1,17 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"os"
 
 	"github.com/joho/godotenv"
 )
 
-func LoadEnv() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
+// LoadEnv reads .env when there is one. Containers usually pass the
+// environment directly, so a missing file is not an error.
+func LoadEnv() error {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
 	}
+	return nil
 }
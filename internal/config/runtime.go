@@ -0,0 +1,213 @@
+package config
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Snapshot is one version of the configuration. It never changes once published.
+type Snapshot struct {
+	Version  uint64    `json:"version"`
+	LoadedAt time.Time `json:"loaded_at"`
+	Config   *Config   `json:"config"`
+}
+
+// Runtime holds the active configuration and swaps it when the config is reloaded
+type Runtime struct {
+	args []string
+
+	mu       sync.Mutex // serializes reloads
+	current  atomic.Pointer[Snapshot]
+	appliers []func(*Config) (Change, error)
+}
+
+// Change is a reload of one component that has been prepared but not made yet
+type Change struct {
+	// Commit switches the component to the new config and cannot fail
+	Commit func()
+	// Discard releases what was prepared when the reload is abandoned
+	Discard func()
+}
+
+func NewRuntime(cfg *Config, args []string) *Runtime {
+	rt := &Runtime{args: args}
+	rt.current.Store(&Snapshot{Version: 1, LoadedAt: time.Now(), Config: cfg})
+	return rt
+}
+
+// Current returns the latest snapshot. Request handlers should use SnapshotFrom
+// so a request sees one version from start to end.
+func (rt *Runtime) Current() *Snapshot {
+	return rt.current.Load()
+}
+
+// OnReload registers a function that prepares a running component for a new
+// config. It checks the config and builds what the component needs without
+// changing anything live, the returned Change makes the switch. Appliers run
+// in registration order and a failing one aborts the reload.
+func (rt *Runtime) OnReload(prepare func(*Config) (Change, error)) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.appliers = append(rt.appliers, prepare)
+}
+
+// Reload reads the configuration again and publishes it as a new snapshot.
+// Only CORS, rate limits, upstream addresses and the log level change at
+// runtime, every other setting keeps its startup value until a restart.
+func (rt *Runtime) Reload() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	next, err := Load(rt.args)
+	if err != nil {
+		return err
+	}
+	previous := rt.current.Load()
+	keepStatic(previous.Config, next)
+
+	// Prepare every component first, so a rejected config leaves all of them
+	// on the running version
+	changes := make([]Change, 0, len(rt.appliers))
+	for _, prepare := range rt.appliers {
+		change, err := prepare(next)
+		if err != nil {
+			for _, prepared := range changes {
+				if prepared.Discard != nil {
+					prepared.Discard()
+				}
+			}
+			return err
+		}
+		changes = append(changes, change)
+	}
+	for _, change := range changes {
+		if change.Commit != nil {
+			change.Commit()
+		}
+	}
+	rt.current.Store(&Snapshot{Version: previous.Version + 1, LoadedAt: time.Now(), Config: next})
+	log.Printf("Configuration reloaded, version %d", previous.Version+1)
+	return nil
+}
+
+// keepStatic copies the sections that need a restart from the running config
+func keepStatic(running, next *Config) {
+	for _, section := range []struct {
+		name          string
+		running, next interface{}
+	}{
+		{"server", &running.Server, &next.Server},
+		{"jwt", &running.JWT, &next.JWT},
+		{"security", &running.Security, &next.Security},
+		{"google", &running.Google, &next.Google},
+		{"dialogflow", &running.DialogFlow, &next.DialogFlow},
+		{"retries", &running.Retries, &next.Retries},
+		{"tracing", &running.Tracing, &next.Tracing},
+		{"audit", &running.Audit, &next.Audit},
+	} {
+		if !reflect.DeepEqual(section.running, section.next) {
+			log.Printf("Configuration section %q changed, it takes effect after a restart", section.name)
+		}
+	}
+	next.Server = running.Server
+	next.JWT = running.JWT
+	next.Security = running.Security
+	next.Google = running.Google
+	next.DialogFlow = running.DialogFlow
+	next.Retries = running.Retries
+	next.Tracing = running.Tracing
+	next.Audit = running.Audit
+
+	// Addresses and breakers of an upstream reload, its transport and balancing
+	// are fixed when the connection is set up
+	for _, upstream := range []struct {
+		name          string
+		running, next *UpstreamTarget
+	}{
+		{"upstreams.user", &running.Upstreams.User, &next.Upstreams.User},
+		{"upstreams.appointment", &running.Upstreams.Appointment, &next.Upstreams.Appointment},
+		{"upstreams.payment", &running.Upstreams.Payment, &next.Upstreams.Payment},
+	} {
+		if !reflect.DeepEqual(upstream.running.TLS, upstream.next.TLS) {
+			log.Printf("Configuration section %q changed, it takes effect after a restart", upstream.name+".tls")
+		}
+		if upstream.running.Balancer != upstream.next.Balancer {
+			log.Printf("Balancing of %q changed, it takes effect after a restart", upstream.name)
+		}
+		upstream.next.TLS = upstream.running.TLS
+		upstream.next.Balancer = upstream.running.Balancer
+	}
+}
+
+// Watch reloads on SIGHUP and whenever the config file changes, until ctx ends
+func (rt *Runtime) Watch(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	cfg := rt.Current().Config
+	var poll <-chan time.Time
+	if cfg.File() != "" && cfg.Server.ConfigPollInterval > 0 {
+		ticker := time.NewTicker(cfg.Server.ConfigPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	lastMod := modTime(cfg.File())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			log.Println("SIGHUP received, reloading configuration")
+		case <-poll:
+			mod := modTime(cfg.File())
+			if mod.Equal(lastMod) {
+				continue
+			}
+			lastMod = mod
+			log.Printf("Config file %s changed, reloading configuration", cfg.File())
+		}
+		if err := rt.Reload(); err != nil {
+			log.Printf("Configuration reload failed, keeping version %d:\n%v", rt.Current().Version, err)
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	if path == "" {
+		return time.Time{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+type snapshotKey struct{}
+
+// Middleware pins the current snapshot to the request, so a reload does not
+// change the settings of requests already in flight
+func (rt *Runtime) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), snapshotKey{}, rt.Current())
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// SnapshotFrom returns the snapshot pinned to the request, or the current one
+func (rt *Runtime) SnapshotFrom(ctx context.Context) *Snapshot {
+	if snapshot, ok := ctx.Value(snapshotKey{}).(*Snapshot); ok {
+		return snapshot
+	}
+	return rt.Current()
+}
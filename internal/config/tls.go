@@ -0,0 +1,123 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TLSConfig makes the gateway terminate TLS itself
+type TLSConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// MinVersion is "1.2" or "1.3"
+	MinVersion string `json:"min_version" yaml:"min_version"`
+	// CipherSuites restricts the TLS 1.2 suites by Go name, empty keeps Go's defaults
+	CipherSuites []string `json:"cipher_suites" yaml:"cipher_suites"`
+	// ReloadInterval is how often the certificate files are checked for changes
+	ReloadInterval time.Duration `json:"reload_interval" yaml:"reload_interval"`
+	// RedirectAddr, when set, serves plain HTTP there and redirects it to HTTPS
+	RedirectAddr string     `json:"redirect_addr" yaml:"redirect_addr"`
+	HSTS         HSTSConfig `json:"hsts" yaml:"hsts"`
+}
+
+type HSTSConfig struct {
+	// MaxAge of zero disables the Strict-Transport-Security header
+	MaxAge            time.Duration `json:"max_age" yaml:"max_age"`
+	IncludeSubdomains bool          `json:"include_subdomains" yaml:"include_subdomains"`
+	Preload           bool          `json:"preload" yaml:"preload"`
+}
+
+// Enabled reports whether TLS is configured
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Validate checks the settings and that the certificate can be loaded
+func (t TLSConfig) Validate(section string) error {
+	var errs []error
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("%s: cert_file and key_file must be set together", section))
+	}
+	if _, err := tlsVersion(t.MinVersion); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", section, err))
+	}
+	if _, err := cipherSuites(t.CipherSuites); err != nil {
+		errs = append(errs, fmt.Errorf("%s: %v", section, err))
+	}
+	if t.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("%s: reload_interval must not be negative", section))
+	}
+	if !t.Enabled() && (t.RedirectAddr != "" || t.HSTS.MaxAge > 0) {
+		errs = append(errs, fmt.Errorf("%s: redirect_addr and hsts need a certificate", section))
+	}
+	if t.CertFile != "" && t.KeyFile != "" {
+		if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", section, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// HSTSHeader returns the Strict-Transport-Security value, or "" when disabled
+func (h HSTSConfig) HSTSHeader() string {
+	if h.MaxAge <= 0 {
+		return ""
+	}
+	value := fmt.Sprintf("max-age=%d", int(h.MaxAge.Seconds()))
+	if h.IncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	if h.Preload {
+		value += "; preload"
+	}
+	return value
+}
+
+// ServerTLSConfig builds the listener TLS settings around a certificate
+// callback, usually that of a reloading certificate
+func (t TLSConfig) ServerTLSConfig(getCertificate func(*tls.ClientHelloInfo) (*tls.Certificate, error)) (*tls.Config, error) {
+	version, err := tlsVersion(t.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := cipherSuites(t.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     version,
+		CipherSuites:   suites,
+		GetCertificate: getCertificate,
+	}, nil
+}
+
+func tlsVersion(name string) (uint16, error) {
+	switch name {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported min_version %q, use 1.2 or 1.3", name)
+}
+
+func cipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ids []uint16
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Trace exporters
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterOTLP   = "otlp"
+)
+
+// OTLP transports
+const (
+	OTLPGRPC = "grpc"
+	OTLPHTTP = "http/protobuf"
+)
+
+type TracingConfig struct {
+	// Exporter is none, stdout or otlp. With none the gateway records nothing
+	// but still passes the trace context of callers on to the upstreams.
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// Endpoint is the OTLP collector, host:port for grpc or a URL for http/protobuf.
+	// Empty falls back to OTEL_EXPORTER_OTLP_ENDPOINT and the exporter default.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Protocol is grpc or http/protobuf
+	Protocol string `json:"protocol" yaml:"protocol"`
+	// Insecure talks to the collector without TLS
+	Insecure    bool   `json:"insecure" yaml:"insecure"`
+	ServiceName string `json:"service_name" yaml:"service_name"`
+	// SampleRatio is the share of new traces that are recorded. Requests that
+	// carry a traceparent follow the sampling decision of their caller.
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+func (t TracingConfig) Validate() error {
+	var errs []error
+	switch t.Exporter {
+	case ExporterNone, ExporterStdout:
+	case ExporterOTLP:
+		if t.Protocol != OTLPGRPC && t.Protocol != OTLPHTTP {
+			errs = append(errs, fmt.Errorf("tracing.protocol must be %s or %s, got %q", OTLPGRPC, OTLPHTTP, t.Protocol))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing.exporter (TRACING_EXPORTER) must be none, stdout or otlp, got %q", t.Exporter))
+	}
+	if t.ServiceName == "" {
+		errs = append(errs, errors.New("tracing.service_name is required"))
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing.sample_ratio must be between 0 and 1"))
+	}
+	return errors.Join(errs...)
+}
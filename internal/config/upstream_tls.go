@@ -0,0 +1,89 @@
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// Transport security modes of an upstream connection
+const (
+	UpstreamPlaintext = "none"
+	UpstreamTLS       = "tls"
+	UpstreamMTLS      = "mtls"
+)
+
+// UpstreamTarget is one backend service. In YAML it is either the address
+// alone or a mapping with the transport settings.
+type UpstreamTarget struct {
+	// Target is host:port or a gRPC target such as dns:///host:port
+	Target string `json:"target" yaml:"target"`
+	// Addresses is a static list of replicas, used instead of Target
+	Addresses []string `json:"addresses" yaml:"addresses"`
+	// Balancer is pick_first, round_robin or least_request
+	Balancer string            `json:"balancer" yaml:"balancer"`
+	TLS      UpstreamTLSConfig `json:"tls" yaml:"tls"`
+	Breaker  BreakerConfig     `json:"breaker" yaml:"breaker"`
+}
+
+// UnmarshalYAML keeps the short form `user: host:port` working
+func (u *UpstreamTarget) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&u.Target)
+	}
+	type plain UpstreamTarget
+	return node.Decode((*plain)(u))
+}
+
+type UpstreamTLSConfig struct {
+	// Mode is none, tls or mtls
+	Mode string `json:"mode" yaml:"mode"`
+	// CAFile verifies the server, empty uses the system roots
+	CAFile string `json:"ca_file" yaml:"ca_file"`
+	// CertFile and KeyFile are the client certificate for mtls
+	CertFile string `json:"cert_file" yaml:"cert_file"`
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// ServerName overrides the SNI and the name the server certificate must match
+	ServerName string `json:"server_name" yaml:"server_name"`
+	// Authority overrides the :authority header, for example behind a proxy
+	Authority string `json:"authority" yaml:"authority"`
+	// ReloadInterval is how often the certificate files are checked for changes
+	ReloadInterval time.Duration `json:"reload_interval" yaml:"reload_interval"`
+}
+
+// Validate checks the settings and that every certificate file can be loaded
+func (t UpstreamTLSConfig) Validate(section string) error {
+	var errs []error
+	switch t.Mode {
+	case "", UpstreamPlaintext:
+		if t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" || t.ServerName != "" {
+			errs = append(errs, fmt.Errorf("%s: certificates and server_name need mode tls or mtls", section))
+		}
+	case UpstreamTLS:
+		if t.CertFile != "" || t.KeyFile != "" {
+			errs = append(errs, fmt.Errorf("%s: a client certificate needs mode mtls", section))
+		}
+	case UpstreamMTLS:
+		if t.CertFile == "" || t.KeyFile == "" {
+			errs = append(errs, fmt.Errorf("%s: mtls needs cert_file and key_file", section))
+		} else if _, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", section, err))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("%s: unknown mode %q, use none, tls or mtls", section, t.Mode))
+	}
+	if t.CAFile != "" {
+		if _, err := utils.LoadCAPool(t.CAFile); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", section, err))
+		}
+	}
+	if t.ReloadInterval < 0 {
+		errs = append(errs, fmt.Errorf("%s: reload_interval must not be negative", section))
+	}
+	return errors.Join(errs...)
+}
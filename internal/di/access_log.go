@@ -0,0 +1,51 @@
+package di
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// quietRoutes are polled every few seconds by orchestrators and monitoring,
+// they are left out of the access log
+var quietRoutes = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+	"/metrics": true,
+}
+
+// AccessLog writes one entry per request with the method, route template,
+// status, latency, response size and the authenticated user. It logs no
+// request or response bodies.
+func AccessLog(next http.Handler, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeFrom(r)
+		if quietRoutes[route] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := utils.TrackIdentity(r.Context())
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		identity := utils.IdentityFrom(ctx)
+		status := recorder.status()
+		entry := logger.WithContext(ctx).WithFields(logrus.Fields{
+			"method":     r.Method,
+			"route":      route,
+			"status":     status,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":      recorder.bytes,
+			"user_id":    identity.UserID,
+			"role":       identity.Role,
+		})
+		if status >= http.StatusInternalServerError {
+			entry.Error("Request failed")
+			return
+		}
+		entry.Info("Request handled")
+	})
+}
@@ -1,22 +1,284 @@
 package di
 
-import "net/http"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
-// CORS middleware to handle CORS requests
-func CORS(next http.Handler) http.Handler {
+	"github.com/gorilla/mux"
+)
+
+// CORSPolicy is the cross-origin policy applied to browser requests. The rule
+// with the longest matching path prefix decides for a request.
+type CORSPolicy struct {
+	Rules []CORSRule `json:"rules" yaml:"rules"`
+}
+
+// CORSRule is the policy of every path below PathPrefix
+type CORSRule struct {
+	PathPrefix string `json:"path_prefix" yaml:"path_prefix"`
+	// AllowedOrigins are exact origins, "https://*.example.com" for any
+	// subdomain, or "*" for any origin
+	AllowedOrigins   []string      `json:"allowed_origins" yaml:"allowed_origins"`
+	AllowedHeaders   []string      `json:"allowed_headers" yaml:"allowed_headers"`
+	ExposedHeaders   []string      `json:"exposed_headers" yaml:"exposed_headers"`
+	AllowCredentials bool          `json:"allow_credentials" yaml:"allow_credentials"`
+	MaxAge           time.Duration `json:"max_age" yaml:"max_age"`
+}
+
+// defaultCORSOrigins are the browser origins of the HospConnect front end
+var defaultCORSOrigins = []string{"https://hilofy.online", "https://*.hilofy.online"}
+
+// credentialedPrefixes are the API prefixes browsers call with the session cookies
+var credentialedPrefixes = []string{"/api/v1/admin", "/api/v1/doctor", "/api/v1/patient", "/api/v1/payment"}
+
+// DefaultCORSPolicy allows the front end origins only. The role APIs get their
+// own rules that allow credentials, other origins need explicit configuration.
+func DefaultCORSPolicy() CORSPolicy {
+	rule := func(prefix string, credentials bool) CORSRule {
+		return CORSRule{
+			PathPrefix:       prefix,
+			AllowedOrigins:   append([]string(nil), defaultCORSOrigins...),
+			AllowedHeaders:   []string{"Content-Type", "Authorization", "X-Token-Delivery", "X-Request-ID"},
+			ExposedHeaders:   []string{"X-Request-ID"},
+			AllowCredentials: credentials,
+			MaxAge:           10 * time.Minute,
+		}
+	}
+	rules := []CORSRule{rule("/", false)}
+	for _, prefix := range credentialedPrefixes {
+		rules = append(rules, rule(prefix, true))
+	}
+	return CORSPolicy{Rules: rules}
+}
+
+// Validate reports rules that browsers would reject or that are unsafe
+func (p CORSPolicy) Validate() error {
+	var errs []error
+	if len(p.Rules) == 0 {
+		errs = append(errs, errors.New("cors.rules must not be empty"))
+	}
+	seen := make(map[string]bool)
+	for _, rule := range p.Rules {
+		if !strings.HasPrefix(rule.PathPrefix, "/") {
+			errs = append(errs, fmt.Errorf("cors rule %q: path_prefix must start with /", rule.PathPrefix))
+		}
+		if seen[rule.PathPrefix] {
+			errs = append(errs, fmt.Errorf("cors rule %q: duplicate path_prefix", rule.PathPrefix))
+		}
+		seen[rule.PathPrefix] = true
+		if len(rule.AllowedOrigins) == 0 {
+			errs = append(errs, fmt.Errorf("cors rule %q: allowed_origins must not be empty", rule.PathPrefix))
+		}
+		for _, origin := range rule.AllowedOrigins {
+			if origin == "*" {
+				if rule.AllowCredentials {
+					errs = append(errs, fmt.Errorf("cors rule %q: allow_credentials needs explicit origins, not *", rule.PathPrefix))
+				}
+				continue
+			}
+			if err := validOriginPattern(origin); err != nil {
+				errs = append(errs, fmt.Errorf("cors rule %q: %v", rule.PathPrefix, err))
+			}
+		}
+		if rule.MaxAge < 0 {
+			errs = append(errs, fmt.Errorf("cors rule %q: max_age must not be negative", rule.PathPrefix))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validOriginPattern(origin string) error {
+	scheme, host, ok := strings.Cut(origin, "://")
+	if !ok || scheme == "" || host == "" || strings.Contains(host, "/") {
+		return fmt.Errorf("origin %q must look like scheme://host[:port]", origin)
+	}
+	if strings.Contains(host, "*") && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") > 1) {
+		return fmt.Errorf("origin %q: a wildcard is only allowed as the first label", origin)
+	}
+	return nil
+}
+
+// rule returns the rule with the longest prefix matching the path
+func (p CORSPolicy) rule(path string) (CORSRule, bool) {
+	var best CORSRule
+	found := false
+	for _, rule := range p.Rules {
+		if matchesPrefix(path, rule.PathPrefix) && (!found || len(rule.PathPrefix) > len(best.PathPrefix)) {
+			best, found = rule, true
+		}
+	}
+	return best, found
+}
+
+// matchesPrefix reports whether path is prefix or lies below it, so
+// "/api/v1/admin" covers "/api/v1/admin/list" but not "/api/v1/administrator"
+func matchesPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+func (rule CORSRule) allowsOrigin(origin string) bool {
+	for _, allowed := range rule.AllowedOrigins {
+		switch {
+		case allowed == "*":
+			return true
+		case strings.EqualFold(allowed, origin):
+			return true
+		case strings.Contains(allowed, "://*."):
+			// "https://*.example.com" matches "https://app.example.com"
+			prefix, suffix, _ := strings.Cut(allowed, "*")
+			origin := strings.ToLower(origin)
+			prefix, suffix = strings.ToLower(prefix), strings.ToLower(suffix)
+			if strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				label := origin[len(prefix) : len(origin)-len(suffix)]
+				if label != "" && !strings.ContainsAny(label, "/:") {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (rule CORSRule) allowsHeaders(requested string) bool {
+	for _, header := range strings.Split(requested, ",") {
+		header = strings.TrimSpace(header)
+		if header == "" {
+			continue
+		}
+		allowed := false
+		for _, candidate := range rule.AllowedHeaders {
+			if candidate == "*" || strings.EqualFold(candidate, header) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// corsMethods are the methods a route is probed for during a preflight
+var corsMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// routeMethods returns the methods the router serves for the path of r
+func routeMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range corsMethods {
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		var match mux.RouteMatch
+		if router.Match(probe, &match) && match.MatchErr == nil {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS middleware to handle CORS requests. The policy is looked up per request
+// so it can change while the gateway runs, and preflights are answered with the
+// methods the router has registered for the path.
+func CORS(next http.Handler, router *mux.Router, policy func(*http.Request) CORSPolicy) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*") // Change '*' to your frontend origin in production
-		w.Header().Set("Access-Control-Allow-Methods", "POST")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		// Every response depends on the Origin, also the ones to requests
+		// without it, so a shared cache never serves them cross-origin
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			// Not a cross-origin browser request
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rule, ok := policy(r).rule(r.URL.Path)
+		allowed := ok && rule.allowsOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if !preflight {
+			if allowed {
+				setAllowOrigin(w, rule, origin)
+				if len(rule.ExposedHeaders) > 0 {
+					w.Header().Set("Access-Control-Expose-Headers", strings.Join(rule.ExposedHeaders, ", "))
+				}
+			}
+			// WebSocket upgrades check the origin against the same rule
+			ctx := context.WithValue(r.Context(), corsOriginKey{}, allowed)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
 
 		// Handle preflight requests
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusOK)
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		methods := routeMethods(router, r)
+		requestedHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !allowed || !contains(methods, r.Header.Get("Access-Control-Request-Method")) || !rule.allowsHeaders(requestedHeaders) {
+			w.WriteHeader(http.StatusForbidden)
 			return
 		}
 
-		// Call the next handler
-		next.ServeHTTP(w, r)
+		setAllowOrigin(w, rule, origin)
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if requestedHeaders != "" {
+			// Echo the checked list, "*" is not honoured together with credentials
+			w.Header().Set("Access-Control-Allow-Headers", requestedHeaders)
+		}
+		if rule.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(rule.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
 	})
 }
+
+type corsOriginKey struct{}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin that accepts same-origin
+// pages and the origins the CORS rule of the path allows. Chats authenticate
+// with the session cookie or the query token behind JWTMiddleware, and a
+// browser sends the cookie along from any origin, so any other origin could
+// open them as the signed-in user.
+func CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		// Not a browser, it sends no cookies on its own
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	allowed, _ := r.Context().Value(corsOriginKey{}).(bool)
+	return allowed
+}
+
+func setAllowOrigin(w http.ResponseWriter, rule CORSRule, origin string) {
+	if rule.AllowCredentials {
+		// Browsers refuse "*" together with credentials
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		return
+	}
+	if contains(rule.AllowedOrigins, "*") {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+}
@@ -0,0 +1,124 @@
+package di
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCORSRuleWildcardSubdomain(t *testing.T) {
+	rule := CORSRule{AllowedOrigins: []string{"https://hilofy.online", "https://*.hilofy.online", "http://*.localhost:3000"}}
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://hilofy.online", true},
+		{"https://app.hilofy.online", true},
+		{"https://admin.app.hilofy.online", true},
+		{"https://APP.Hilofy.Online", true},
+		{"http://web.localhost:3000", true},
+		// The wildcard needs a label and keeps the scheme and port
+		{"https://.hilofy.online", false},
+		{"http://app.hilofy.online", false},
+		{"https://app.hilofy.online:8443", false},
+		{"http://web.localhost:3001", false},
+		{"http://web.localhost", false},
+		// Lookalike hosts
+		{"https://evilhilofy.online", false},
+		{"https://app.hilofy.online.evil.com", false},
+		{"https://evil.com/.hilofy.online", false},
+		{"https://evil.com:443.hilofy.online", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := rule.allowsOrigin(tt.origin); got != tt.want {
+				t.Errorf("allowsOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSDefaultPolicy(t *testing.T) {
+	router := mux.NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		if !CheckOrigin(r) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}
+	router.HandleFunc("/api/v1/patient/profile", ok).Methods("GET")
+	router.HandleFunc("/api/v1/public", ok).Methods("GET")
+	handler := CORS(router, router, func(*http.Request) CORSPolicy { return DefaultCORSPolicy() })
+
+	tests := []struct {
+		name, path, origin string
+		wantAllowOrigin    string
+		wantCredentials    bool
+		wantStatus         int
+	}{
+		{name: "no origin", path: "/api/v1/patient/profile", wantStatus: http.StatusOK},
+		{name: "subdomain on a credentialed prefix", path: "/api/v1/patient/profile", origin: "https://app.hilofy.online",
+			wantAllowOrigin: "https://app.hilofy.online", wantCredentials: true, wantStatus: http.StatusOK},
+		{name: "apex on a public path", path: "/api/v1/public", origin: "https://hilofy.online",
+			wantAllowOrigin: "https://hilofy.online", wantStatus: http.StatusOK},
+		{name: "foreign origin", path: "/api/v1/patient/profile", origin: "https://evil.example", wantStatus: http.StatusForbidden},
+		{name: "lookalike origin", path: "/api/v1/patient/profile", origin: "https://evilhilofy.online", wantStatus: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d (CheckOrigin)", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %v, want %v", got, tt.wantCredentials)
+			}
+			if got := w.Header().Get("Vary"); got != "Origin" {
+				t.Errorf("Vary = %q, want Origin", got)
+			}
+		})
+	}
+}
+
+func TestCORSRulePathPrefix(t *testing.T) {
+	policy := CORSPolicy{Rules: []CORSRule{
+		{PathPrefix: "/", MaxAge: 1},
+		{PathPrefix: "/api/v1/admin", MaxAge: 2},
+		{PathPrefix: "/api/v1/patient/", MaxAge: 3},
+	}}
+	tests := []struct {
+		path string
+		want time.Duration
+	}{
+		{"/api/v1/admin", 2},
+		{"/api/v1/admin/", 2},
+		{"/api/v1/admin/patient/list", 2},
+		{"/api/v1/patient/profile", 3},
+		// A prefix only covers whole path segments
+		{"/api/v1/administrator", 1},
+		{"/api/v1/admin-tools/list", 1},
+		{"/api/v1/patient", 1},
+		{"/api/v1/patients", 1},
+		{"/", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rule, ok := policy.rule(tt.path)
+			if !ok || rule.MaxAge != tt.want {
+				t.Errorf("rule(%q) is the one with max age %v, want %v", tt.path, rule.MaxAge, tt.want)
+			}
+		})
+	}
+}
@@ -8,22 +8,41 @@ import (
 	"io"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"golang.org/x/oauth2/google"
 )
 
-var cachedToken string
-var tokenExpiryTime time.Time
+// DialogFlowClient answers help desk messages with a Dialogflow agent
+type DialogFlowClient struct {
+	credentials []byte
+	projectID   string
 
-func GetAccessToken() (string, error) {
+	mu              sync.Mutex
+	cachedToken     string
+	tokenExpiryTime time.Time
+}
+
+func NewDialogFlowClient(credentialsJSON []byte, projectID string) *DialogFlowClient {
+	return &DialogFlowClient{
+		credentials: credentialsJSON,
+		projectID:   projectID,
+	}
+}
+
+func (d *DialogFlowClient) GetAccessToken(ctx context.Context) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	currentTime := time.Now()
 
 	// Return cached token if still valid
-	if cachedToken != "" && tokenExpiryTime.After(currentTime) {
-		return cachedToken, nil
+	if d.cachedToken != "" && d.tokenExpiryTime.After(currentTime) {
+		return d.cachedToken, nil
+	}
+	if len(d.credentials) == 0 {
+		return "", fmt.Errorf("dialogflow credentials are not configured")
 	}
 
 	// // Path to the JSON file
@@ -36,7 +55,7 @@ func GetAccessToken() (string, error) {
 	// }
 
 	// Parse credentials and get the token
-	creds, err := google.CredentialsFromJSON(context.Background(), []byte(os.Getenv("DIALOG_FLOW_CREDENTIALS_JSON")), "https://www.googleapis.com/auth/cloud-platform")
+	creds, err := google.CredentialsFromJSON(ctx, d.credentials, "https://www.googleapis.com/auth/cloud-platform")
 	if err != nil {
 		return "", fmt.Errorf("failed to parse credentials: %v", err)
 	}
@@ -47,11 +66,11 @@ func GetAccessToken() (string, error) {
 	}
 
 	// Cache the token and its expiry time
-	log.Printf("New token retrieved: %s", token.AccessToken)
-	cachedToken = token.AccessToken
-	tokenExpiryTime = token.Expiry
+	log.Printf("New Dialogflow access token retrieved, valid until %s", token.Expiry.Format(time.RFC3339))
+	d.cachedToken = token.AccessToken
+	d.tokenExpiryTime = token.Expiry
 
-	return cachedToken, nil
+	return d.cachedToken, nil
 }
 
 func HelpDeskRender(w http.ResponseWriter, r *http.Request) {
@@ -60,7 +79,7 @@ func HelpDeskRender(w http.ResponseWriter, r *http.Request) {
 }
 
 // Function to handle the chatbot request
-func HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
+func (d *DialogFlowClient) HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
 	var reqBody struct {
 		Message string `json:"message"`
 	}
@@ -69,8 +88,7 @@ func HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("err", err)
 		return
 	}
-	log.Println("request message : ", reqBody)
-	token, err := GetAccessToken()
+	token, err := d.GetAccessToken(r.Context())
 	if err != nil {
 		http.Error(w, "Error getting access token", http.StatusInternalServerError)
 		fmt.Println("errr", err)
@@ -78,7 +96,7 @@ func HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build Dialogflow API request
-	url := "https://dialogflow.googleapis.com/v2/projects/docto-sheduler/agent/sessions/12345:detectIntent"
+	url := fmt.Sprintf("https://dialogflow.googleapis.com/v2/projects/%s/agent/sessions/12345:detectIntent", d.projectID)
 	dialogflowRequest := map[string]interface{}{
 		"queryInput": map[string]interface{}{
 			"text": map[string]string{
@@ -91,7 +109,7 @@ func HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
 	// Make the Dialogflow request
 	client := &http.Client{}
 	reqBodyJson, _ := json.Marshal(dialogflowRequest)
-	req, _ := http.NewRequest("POST", url, io.NopCloser(bytes.NewReader(reqBodyJson)))
+	req, _ := http.NewRequestWithContext(r.Context(), "POST", url, io.NopCloser(bytes.NewReader(reqBodyJson)))
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
@@ -114,7 +132,6 @@ func HelpDeskHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Error getting fulfillment text", http.StatusInternalServerError)
 		return
 	}
-	log.Println("fulfillment text : ", fulfillmentText)
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(map[string]string{
 		"reply": fulfillmentText,
@@ -0,0 +1,135 @@
+package di
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// unmatchedRoute labels requests no route matched, so unknown paths cannot
+// add label values
+const unmatchedRoute = "unmatched"
+
+type routeKey struct{}
+
+// Route matches the request against the router once and puts the path template
+// of the matched route on the context, where Metrics, Tracing and AccessLog
+// read it. It must wrap all three.
+func Route(next http.Handler, router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), routeKey{}, routeTemplate(router, r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// routeFrom returns the route template Route resolved for the request
+func routeFrom(r *http.Request) string {
+	if route, ok := r.Context().Value(routeKey{}).(string); ok {
+		return route
+	}
+	return unmatchedRoute
+}
+
+// Metrics records the request counter, latency, response size and in-flight
+// metrics of every request. Requests are labelled with the path template of the
+// route the router matches, never the raw path, which holds ids.
+func Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeFrom(r)
+		inFlight := requestsInFlight.WithLabelValues(route, r.Method)
+		inFlight.Inc()
+		defer inFlight.Dec()
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		code := strconv.Itoa(recorder.status())
+		requestCount.WithLabelValues(route, r.Method, code).Inc()
+		requestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+		responseSize.WithLabelValues(route, r.Method, code).Observe(float64(recorder.bytes))
+	})
+}
+
+func routeTemplate(router *mux.Router, r *http.Request) string {
+	var match mux.RouteMatch
+	if !router.Match(r, &match) || match.Route == nil {
+		return unmatchedRoute
+	}
+	template, err := match.Route.GetPathTemplate()
+	if err != nil {
+		return unmatchedRoute
+	}
+	return template
+}
+
+// statusRecorder remembers the status code and counts the body bytes
+type statusRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.code == 0 {
+		s.code = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(data []byte) (int, error) {
+	if s.code == 0 {
+		s.code = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(data)
+	s.bytes += n
+	return n, err
+}
+
+func (s *statusRecorder) status() int {
+	if s.code == 0 {
+		return http.StatusOK
+	}
+	return s.code
+}
+
+// Hijack lets the chat WebSockets upgrade through the recorder
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	s.code = http.StatusSwitchingProtocols
+	return hijacker.Hijack()
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// UpstreamMetrics is a gRPC client interceptor that counts and times the calls
+// to one upstream service by method and status code
+func UpstreamMetrics(upstream string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		code := status.Code(err).String()
+		upstreamRequests.WithLabelValues(upstream, method, code).Inc()
+		upstreamDuration.WithLabelValues(upstream, method, code).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
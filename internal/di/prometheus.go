@@ -8,10 +8,91 @@ var (
 			Name: "api_requests_total",
 			Help: "Total number of requests processed",
 		},
-		[]string{"method"},
+		[]string{"route", "method", "code"},
+	)
+
+	requestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_request_duration_seconds",
+			Help:    "Time taken to serve a request, by route template, method and status code",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	responseSize = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "api_response_size_bytes",
+			Help:    "Size of response bodies, by route template, method and status code",
+			Buckets: prometheus.ExponentialBuckets(100, 10, 7),
+		},
+		[]string{"route", "method", "code"},
+	)
+
+	requestsInFlight = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "api_requests_in_flight",
+			Help: "Number of requests being served, by route template and method",
+		},
+		[]string{"route", "method"},
+	)
+
+	upstreamRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_requests_total",
+			Help: "Total number of gRPC calls to upstream services, by upstream, method and status code",
+		},
+		[]string{"upstream", "method", "code"},
+	)
+
+	upstreamDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "upstream_request_duration_seconds",
+			Help:    "Time taken by gRPC calls to upstream services, retries included",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"upstream", "method", "code"},
+	)
+
+	// LoginLockouts counts emails and client IPs that reached a full sign-in lockout
+	LoginLockouts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_lockouts_total",
+			Help: "Total number of sign-in lockouts by role and scope (email or ip)",
+		},
+		[]string{"role", "scope"},
+	)
+
+	// LoginRejections counts sign-in attempts refused while backing off or locked
+	LoginRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "login_rejected_total",
+			Help: "Total number of sign-in attempts rejected by throttling",
+		},
+		[]string{"role"},
+	)
+
+	// UpstreamBreakerState is 1 for the current circuit breaker state of an upstream and 0 for the others
+	UpstreamBreakerState = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "upstream_circuit_breaker_state",
+			Help: "Circuit breaker state by upstream, 1 for the current state (closed, open or half_open)",
+		},
+		[]string{"upstream", "state"},
+	)
+
+	// UpstreamBreakerRejections counts upstream calls refused by an open circuit breaker
+	UpstreamBreakerRejections = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "upstream_circuit_breaker_rejected_total",
+			Help: "Total number of upstream calls rejected by an open circuit breaker",
+		},
+		[]string{"upstream"},
 	)
 )
 
 func init() {
-	prometheus.MustRegister(requestCount)
+	prometheus.MustRegister(requestCount, requestDuration, responseSize, requestsInFlight,
+		upstreamRequests, upstreamDuration,
+		LoginLockouts, LoginRejections, UpstreamBreakerState, UpstreamBreakerRejections)
 }
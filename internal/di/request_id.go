@@ -0,0 +1,37 @@
+package di
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDMetadata is the gRPC metadata key of the request id, metadata keys are lower case
+const requestIDMetadata = "x-request-id"
+
+// RequestID keeps the X-Request-ID of the client, or creates one when it is
+// missing or unusable, puts it on the request context and echoes it in the response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(utils.RequestIDHeader)
+		if !utils.ValidRequestID(id) {
+			id = utils.NewRequestID()
+		}
+		w.Header().Set(utils.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestID(r.Context(), id)))
+	})
+}
+
+// UpstreamRequestID is a gRPC client interceptor that passes the request id
+// on to the upstream as x-request-id metadata
+func UpstreamRequestID() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id := utils.RequestIDFrom(ctx); id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, requestIDMetadata, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
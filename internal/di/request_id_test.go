@@ -0,0 +1,73 @@
+package di
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		// wantKept is set when the id of the client must be used as is
+		wantKept bool
+	}{
+		{name: "id of the client", incoming: "0f8fad5b-d9cb-469f-a165-70867728950e", wantKept: true},
+		{name: "missing id"},
+		{name: "id that would break a log line", incoming: "abc\ninjected=1"},
+		{name: "overlong id", incoming: strings.Repeat("a", 200)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var upstreamIDs []string
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				md, _ := metadata.FromOutgoingContext(ctx)
+				upstreamIDs = md.Get(requestIDMetadata)
+				return nil
+			}
+			var contextID string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contextID = utils.RequestIDFrom(r.Context())
+				UpstreamRequestID()(r.Context(), "/patient.PatientService/GetProfile", nil, nil, nil, invoker)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/api/v1/patient/profile", nil)
+			if tt.incoming != "" {
+				r.Header.Set(utils.RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			echoed := w.Header().Get(utils.RequestIDHeader)
+			if !utils.ValidRequestID(echoed) {
+				t.Fatalf("response id %q is not valid", echoed)
+			}
+			if kept := echoed == tt.incoming; kept != tt.wantKept {
+				t.Errorf("response id %q, client id kept = %v, want %v", echoed, kept, tt.wantKept)
+			}
+			if contextID != echoed {
+				t.Errorf("context id %q, want the response id %q", contextID, echoed)
+			}
+			if len(upstreamIDs) != 1 || upstreamIDs[0] != echoed {
+				t.Errorf("upstream metadata %q, want [%q]", upstreamIDs, echoed)
+			}
+		})
+	}
+}
+
+func TestUpstreamRequestIDOutsideRequest(t *testing.T) {
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if md, _ := metadata.FromOutgoingContext(ctx); len(md.Get(requestIDMetadata)) != 0 {
+			t.Errorf("background call carries request id %q", md.Get(requestIDMetadata))
+		}
+		return nil
+	}
+	UpstreamRequestID()(context.Background(), "/grpc.health.v1.Health/Check", nil, nil, nil, invoker)
+}
@@ -1,22 +1,134 @@
 package di
 
 import (
-	"net/http"
+	"errors"
+	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
 var Upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true 
-	},
+	CheckOrigin: CheckOrigin,
 }
 
 type Message struct {
 	Username string `json:"username"`
 	Text     string `json:"text"`
-	Sender   string `json:"sender"` 
+	Sender   string `json:"sender"`
 }
 
-var PatientConnections = make(map[*websocket.Conn]bool) 
-var CustomerConnections = make(map[*websocket.Conn]bool) 
+// chatWriteTimeout bounds a write to one slow chat client
+const chatWriteTimeout = 10 * time.Second
+
+// ConnectionSet tracks open chat WebSockets so messages can be broadcast to
+// them and they can be closed cleanly on shutdown
+type ConnectionSet struct {
+	mu sync.Mutex
+	// conns maps each connection to the lock that serializes writes to it
+	conns   map[*websocket.Conn]*sync.Mutex
+	closing bool
+	empty   chan struct{} // closed when the set drains during shutdown
+}
+
+func NewConnectionSet() *ConnectionSet {
+	return &ConnectionSet{conns: make(map[*websocket.Conn]*sync.Mutex)}
+}
+
+// Add registers a connection. It returns false once the server is shutting down.
+func (s *ConnectionSet) Add(conn *websocket.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = &sync.Mutex{}
+	return true
+}
+
+// Remove forgets a connection, the caller closes it
+func (s *ConnectionSet) Remove(conn *websocket.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+	if s.closing && len(s.conns) == 0 && s.empty != nil {
+		close(s.empty)
+		s.empty = nil
+	}
+}
+
+// Broadcast sends a text message to every connection. Connections that fail
+// are closed and removed. The set is not locked during the writes, so a slow
+// client only delays this broadcast and not Add, Remove or other broadcasts.
+func (s *ConnectionSet) Broadcast(data []byte) error {
+	type target struct {
+		conn    *websocket.Conn
+		writeMu *sync.Mutex
+	}
+	s.mu.Lock()
+	targets := make([]target, 0, len(s.conns))
+	for conn, writeMu := range s.conns {
+		targets = append(targets, target{conn, writeMu})
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	for _, t := range targets {
+		t.writeMu.Lock()
+		t.conn.SetWriteDeadline(time.Now().Add(chatWriteTimeout))
+		err := t.conn.WriteMessage(websocket.TextMessage, data)
+		t.writeMu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+			t.conn.Close()
+			s.Remove(t.conn)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CloseAll sends a going-away close message to every connection, waits up to
+// grace for clients to hang up and then closes whatever is left
+func (s *ConnectionSet) CloseAll(reason string, grace time.Duration) {
+	s.mu.Lock()
+	s.closing = true
+	empty := make(chan struct{})
+	if len(s.conns) == 0 {
+		close(empty)
+	} else {
+		s.empty = empty
+	}
+	message := websocket.FormatCloseMessage(websocket.CloseGoingAway, reason)
+	for conn := range s.conns {
+		conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-empty:
+	case <-time.After(grace):
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+		delete(s.conns, conn)
+	}
+}
+
+var PatientConnections = NewConnectionSet()
+var CustomerConnections = NewConnectionSet()
+
+// CloseChats closes every open chat WebSocket with a going-away message
+func CloseChats(reason string, grace time.Duration) {
+	var wg sync.WaitGroup
+	for _, set := range []*ConnectionSet{PatientConnections, CustomerConnections} {
+		wg.Add(1)
+		go func(set *ConnectionSet) {
+			defer wg.Done()
+			set.CloseAll(reason, grace)
+		}(set)
+	}
+	wg.Wait()
+}
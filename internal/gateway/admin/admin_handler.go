@@ -1,7 +1,6 @@
 package admin
 
 import (
-	"context"
 	"encoding/json"
 	"io/ioutil"
 	"log"
@@ -14,6 +13,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/audit"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
@@ -22,7 +22,7 @@ import (
 const role = "admin"
 
 func (a *AdminServerClient) AdminSignIn(w http.ResponseWriter, r *http.Request) {
-	a.Logger.Info("AdminSignIn: Starting sign-in process")
+	a.Logger.WithContext(r.Context()).Info("AdminSignIn: Starting sign-in process")
 	var reqBody struct {
 		Email    string `json:"email" validate:"required,email"`    // must be a valid email
 		Password string `json:"password" validate:"required,min=8"` // minimum length of 8 characters
@@ -44,13 +44,19 @@ func (a *AdminServerClient) AdminSignIn(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	attempt := middleware.BeginLogin(w, r, role, reqBody.Email)
+	if attempt == nil {
+		return
+	}
+
 	// Call the Admin gRPC SignIn method
-	resp, err := a.AdminClient.SignIn(context.Background(), &pb.SignInRequest{
+	resp, err := a.AdminClient.SignIn(r.Context(), &pb.SignInRequest{
 		Email:    reqBody.Email,
 		Password: reqBody.Password,
 	})
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		attempt.Failed(r.Context(), err)
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "AdminSignIn",
 			"error":    err.Error(),
 			"email":    reqBody.Email,
@@ -59,28 +65,40 @@ func (a *AdminServerClient) AdminSignIn(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if resp.Status == "success" {
-		jwtToken, err := middleware.CreateJWTToken(reqBody.Email, role)
+	var result *middleware.SignInResult
+	if resp.Status != "success" {
+		attempt.Failed(r.Context(), nil)
+	} else {
+		attempt.Succeeded(r.Context())
+		result, err = middleware.CompleteSignIn(w, r, reqBody.Email, role)
 		if err != nil {
 			utils.JSONResponse(w, "Failed to create JWT token", http.StatusInternalServerError, r)
 			return
 		}
-		middleware.SetJWTToken(w, jwtToken, "admin")
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "AdminSignIn",
 			"email":    reqBody.Email,
 		}).Info("AdminSignIn: JWT token created successfully")
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "AdminSignIn",
 		"email":    reqBody.Email,
 	}).Info("AdminSignIn: Sign-in successful")
-	utils.JSONResponse(w, resp, http.StatusOK, r)
+	utils.JSONResponse(w, struct {
+		*pb.SignInResponse
+		*middleware.SignInResult
+	}{resp, result}, http.StatusOK, r)
 }
 
 // AdminLogout handles admin logout
 func (a *AdminServerClient) AdminLogout(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.EndSession(w, r, role); err != nil {
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "AdminLogout",
+			"error":    err.Error(),
+		}).Error("AdminLogout: Failed to revoke session")
+	}
 	http.SetCookie(w, &http.Cookie{
 		MaxAge:   -1,
 		Name:     "admintoken",
@@ -91,7 +109,7 @@ func (a *AdminServerClient) AdminLogout(w http.ResponseWriter, r *http.Request)
 		Path:     "/",
 	})
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "AdminLogout",
 	}).Info("AdminLogout: Admin logged out successfully")
 	utils.JSONStandardResponse(w, "success", "", "Admin logged out successfully", http.StatusOK, r)
@@ -99,7 +117,7 @@ func (a *AdminServerClient) AdminLogout(w http.ResponseWriter, r *http.Request)
 
 // DoctorRegister handles the doctor registration via gRPC
 func (a *AdminServerClient) DoctorRegister(w http.ResponseWriter, req *http.Request) {
-	a.Logger.Info("DoctorRegister: Starting registration process")
+	a.Logger.WithContext(req.Context()).Info("DoctorRegister: Starting registration process")
 	var reqBody struct {
 		Email            string `json:"email" validate:"required,email"`
 		Password         string `json:"password" validate:"required,min=8"`
@@ -121,15 +139,16 @@ func (a *AdminServerClient) DoctorRegister(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	resp, err := a.AdminClient.AddDoctor(context.Background(), &pb.AddDoctorRequest{
+	resp, err := a.AdminClient.AddDoctor(req.Context(), &pb.AddDoctorRequest{
 		Email:            reqBody.Email,
 		Password:         reqBody.Password,
 		Name:             reqBody.Name,
 		SpecializationId: int32(reqBody.SpecializationId),
 		Phone:            int32(reqBody.Phone),
 	})
+	audit.Log(req.Context(), audit.ActionDoctorRegister, reqBody.Email, audit.OutcomeOf(err, resp.GetStatusCode()))
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "DoctorRegister",
 			"error":    err.Error(),
 			"email":    reqBody.Email,
@@ -138,7 +157,7 @@ func (a *AdminServerClient) DoctorRegister(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "DoctorRegister",
 		"email":    reqBody.Email,
 	}).Info("DoctorRegister: Doctor registered successfully")
@@ -170,14 +189,14 @@ func (a *AdminServerClient) PatientCreate(w http.ResponseWriter, r *http.Request
 	}
 
 	// Call the Patient gRPC Create method
-	resp, err := a.AdminClient.AddPatient(context.Background(), &pb.AddPatientRequest{
+	resp, err := a.AdminClient.AddPatient(r.Context(), &pb.AddPatientRequest{
 		Name:     reqBody.Name,
 		Email:    reqBody.Email,
 		Phone:    int32(reqBody.Phone),
 		Password: reqBody.Password,
 	})
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "PatientCreate",
 			"email":    reqBody.Email,
 			"error":    err.Error(),
@@ -186,7 +205,7 @@ func (a *AdminServerClient) PatientCreate(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "PatientCreate",
 		"email":    reqBody.Email,
 	}).Info("PatientCreate: Patient created successfully")
@@ -201,11 +220,12 @@ func (a *AdminServerClient) PatientDelete(w http.ResponseWriter, r *http.Request
 		utils.JSONStandardResponse(w, "fail", "Patient id is require", "", 400, r)
 	}
 	// Call the Patient gRPC Delete method
-	resp, err := a.AdminClient.DeletePatient(context.Background(), &pb.DeletePatientRequest{
+	resp, err := a.AdminClient.DeletePatient(r.Context(), &pb.DeletePatientRequest{
 		PatientId: patientId,
 	})
+	audit.Log(r.Context(), audit.ActionPatientDelete, patientId, audit.OutcomeOf(err, resp.GetStatusCode()))
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function":  "PatientDelete",
 			"patientId": patientId,
 			"error":     err.Error(),
@@ -214,7 +234,7 @@ func (a *AdminServerClient) PatientDelete(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":  "PatientDelete",
 		"patientId": patientId,
 	}).Info("PatientDelete: Patient deleted successfully")
@@ -235,11 +255,12 @@ func (a *AdminServerClient) DoctorDelete(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Call the Doctor gRPC Delete method
-	resp, err := a.AdminClient.DeleteDoctor(context.Background(), &pb.DeleteDoctorRequest{
+	resp, err := a.AdminClient.DeleteDoctor(r.Context(), &pb.DeleteDoctorRequest{
 		DoctorId: doctorID,
 	})
+	audit.Log(r.Context(), audit.ActionDoctorDelete, doctorID, audit.OutcomeOf(err, resp.GetStatusCode()))
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "DoctorDelete",
 			"doctorID": doctorID,
 			"error":    err.Error(),
@@ -248,7 +269,7 @@ func (a *AdminServerClient) DoctorDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "DoctorDelete",
 		"doctorID": doctorID,
 	}).Info("DoctorDelete: Doctor deleted successfully")
@@ -273,12 +294,13 @@ func (a *AdminServerClient) PatientBlock(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Call the Patient gRPC Block method
-	resp, err := a.AdminClient.BlockPatient(context.Background(), &pb.BlockPatientRequest{
+	resp, err := a.AdminClient.BlockPatient(r.Context(), &pb.BlockPatientRequest{
 		PatientId: patientId,
 		Reason:    reqBody.Reason,
 	})
+	audit.Log(r.Context(), audit.ActionPatientBlock, patientId, audit.OutcomeOf(err, resp.GetStatusCode()))
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function":  "PatientBlock",
 			"patientId": patientId,
 			"error":     err.Error(),
@@ -287,7 +309,18 @@ func (a *AdminServerClient) PatientBlock(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	if resp.Status == "success" {
+		// A blocked patient must lose access right away, not when the token expires
+		if err := middleware.RevokeUserSessions(r.Context(), patientId, "patient"); err != nil {
+			a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+				"function":  "PatientBlock",
+				"patientId": patientId,
+				"error":     err.Error(),
+			}).Error("PatientBlock: Failed to revoke patient sessions")
+		}
+	}
+
+	a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":  "PatientBlock",
 		"patientId": patientId,
 		"reason":    reqBody.Reason,
@@ -297,7 +330,7 @@ func (a *AdminServerClient) PatientBlock(w http.ResponseWriter, r *http.Request)
 
 // ListDoctorsHandler handles the request for listing all doctors
 func (a *AdminServerClient) ListDoctorsHandler(w http.ResponseWriter, req *http.Request) {
-	resp, err := a.AdminClient.ListDoctors(context.Background(), &pb.Empty{})
+	resp, err := a.AdminClient.ListDoctors(req.Context(), &pb.Empty{})
 	if err != nil || resp.Status != "success" {
 		utils.JSONResponse(w, "Failed to list doctors", http.StatusInternalServerError, req)
 		return
@@ -307,7 +340,7 @@ func (a *AdminServerClient) ListDoctorsHandler(w http.ResponseWriter, req *http.
 
 // ListPatientsHandler handles the request for listing all patients
 func (a *AdminServerClient) ListPatientsHandler(w http.ResponseWriter, req *http.Request) {
-	resp, err := a.AdminClient.ListPatients(context.Background(), &pb.Empty{})
+	resp, err := a.AdminClient.ListPatients(req.Context(), &pb.Empty{})
 	if err != nil || resp.Status != "success" {
 		utils.JSONResponse(w, "Failed to list patients", http.StatusInternalServerError, req)
 		return
@@ -317,25 +350,44 @@ func (a *AdminServerClient) ListPatientsHandler(w http.ResponseWriter, req *http
 
 // CustomerCareChatHandler handles WebSocket connections for customer care chat
 func (a *AdminServerClient) CustomerCareChatHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+		return
+	}
 	conn, err := di.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println("Error upgrading customer connection:", err)
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "CustomerCareChatHandler",
+			"error":    err.Error(),
+		}).Error("Error upgrading customer care connection")
+		return
+	}
+	if !di.CustomerConnections.Add(conn) { // Mark the connection as active
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		conn.Close()
 		return
 	}
-	di.CustomerConnections[conn] = true // Mark the connection as active
 	defer func() {
+		di.CustomerConnections.Remove(conn) // Clean up on disconnect
 		conn.Close()
-		delete(di.CustomerConnections, conn) // Clean up on disconnect
 	}()
 
 	for {
 		var message di.Message
 		err := conn.ReadJSON(&message)
 		if err != nil {
-			log.Println("Error reading message from customer:", err)
+			a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+				"function": "CustomerCareChatHandler",
+				"error":    err.Error(),
+			}).Error("Error reading message from customer care")
 			break // Exit the loop on error
 		}
-		log.Printf("Received message from customer care: %s", message)
+		a.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "CustomerCareChatHandler",
+			"adminId":  claims.UserId,
+		}).Info("Received message from customer care")
+		message.Sender = "customer"
 
 		// Route the message to patients
 		sendMessageToPatients(message) // Function to send messages to patients
@@ -349,13 +401,8 @@ func sendMessageToPatients(msg di.Message) {
 		log.Println("Error marshalling message to JSON:", err)
 		return
 	}
-	for conn := range di.PatientConnections {
-		err := conn.WriteMessage(websocket.TextMessage, messageJSON)
-		if err != nil {
-			log.Println("Error sending message to patient:", err)
-			conn.Close()
-			delete(di.PatientConnections, conn)
-		}
+	if err := di.PatientConnections.Broadcast(messageJSON); err != nil {
+		log.Println("Error sending message to patient:", err)
 	}
 }
 
@@ -1,6 +1,8 @@
 package admin
 
 import (
+	"net/http"
+
 	pb "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/admin"
 	"github.com/gorilla/mux"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/appointment"
@@ -24,20 +26,31 @@ func RegisterAdminRoutes(router *mux.Router, adminclient *AdminServerClient, app
 	publicRouter := router.PathPrefix("/api/v1/admin").Subrouter()
 	publicRouter.HandleFunc("/signin", adminclient.AdminSignIn).Methods("POST")
 	publicRouter.HandleFunc("/logout", adminclient.AdminLogout).Methods("POST")
-	publicRouter.HandleFunc("/ws", adminclient.CustomerCareChatHandler)
+	publicRouter.HandleFunc("/token/refresh", middleware.RefreshHandler("admin")).Methods("POST")
+	publicRouter.HandleFunc("/mfa/challenge", middleware.MFAChallengeHandler("admin")).Methods("POST")
 
 	privateRouter := router.PathPrefix("/api/v1/admin").Subrouter()
 	privateRouter.Use(middleware.JWTMiddleware("admin"))
-	privateRouter.HandleFunc("/doctor/register", adminclient.DoctorRegister).Methods("POST")
-	privateRouter.HandleFunc("/doctor/delete/{ID}", adminclient.DoctorDelete).Methods("DELETE")
-	privateRouter.HandleFunc("/patient/register", adminclient.PatientCreate).Methods("POST")
-	privateRouter.HandleFunc("/patient/delete/{ID}", adminclient.PatientDelete).Methods("DELETE")
-	privateRouter.HandleFunc("/patient/block/{ID}", adminclient.PatientBlock)
-	privateRouter.HandleFunc("/patient/list", adminclient.ListPatientsHandler)
-	privateRouter.HandleFunc("/doctor/list", adminclient.ListDoctorsHandler)
-	privateRouter.HandleFunc("/doctor/addcategory", appointmentClient.AddDoctorSpecialization).Methods("POST")
-	privateRouter.HandleFunc("/customer-support", adminclient.AdminChatRender)
-	privateRouter.HandleFunc("/dashboard", appointmentClient.Dashboard)
-	privateRouter.HandleFunc("/dashboard/fetch", appointmentClient.DashboardResponse)
+	privateRouter.HandleFunc("/logout-all", middleware.LogoutEverywhereHandler("admin")).Methods("POST")
+	privateRouter.HandleFunc("/mfa/enroll", middleware.MFAEnrollHandler("admin")).Methods("POST")
+	privateRouter.HandleFunc("/mfa/verify", middleware.MFAVerifyHandler("admin")).Methods("POST")
+
+	// Every admin route declares the permission it needs, so support and finance
+	// admins only reach their part of the panel
+	guard := func(permission string, handler http.HandlerFunc) http.Handler {
+		return middleware.RequirePermission(permission)(handler)
+	}
+	privateRouter.Handle("/doctor/register", guard("doctors:write", adminclient.DoctorRegister)).Methods("POST")
+	privateRouter.Handle("/doctor/delete/{ID}", guard("doctors:delete", adminclient.DoctorDelete)).Methods("DELETE")
+	privateRouter.Handle("/patient/register", guard("patients:write", adminclient.PatientCreate)).Methods("POST")
+	privateRouter.Handle("/patient/delete/{ID}", guard("patients:delete", adminclient.PatientDelete)).Methods("DELETE")
+	privateRouter.Handle("/patient/block/{ID}", guard("patients:block", adminclient.PatientBlock)).Methods("POST")
+	privateRouter.Handle("/patient/list", guard("patients:read", adminclient.ListPatientsHandler)).Methods("GET")
+	privateRouter.Handle("/doctor/list", guard("doctors:read", adminclient.ListDoctorsHandler)).Methods("GET")
+	privateRouter.Handle("/doctor/addcategory", guard("specializations:write", appointmentClient.AddDoctorSpecialization)).Methods("POST")
+	privateRouter.Handle("/customer-support", guard("support:chat", adminclient.AdminChatRender)).Methods("GET")
+	privateRouter.Handle("/ws", guard("support:chat", adminclient.CustomerCareChatHandler)).Methods("GET")
+	privateRouter.Handle("/dashboard", guard("dashboard:read", appointmentClient.Dashboard)).Methods("GET")
+	privateRouter.Handle("/dashboard/fetch", guard("dashboard:read", appointmentClient.DashboardResponse)).Methods("GET")
 
 }
@@ -1,7 +1,6 @@
 package appointment
 
 import (
-	"context"
 	"encoding/json"
 	"net/http"
 	"path/filepath"
@@ -16,7 +15,7 @@ import (
 
 // GetAvailability handles getting availability for a specific category and requested date
 func (p *AppointmentServerClient) GetAvailability(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to get availability")
+	p.Logger.WithContext(r.Context()).Info("Received request to get availability")
 
 	var reqbody struct {
 		CategoryID        int       `json:"categoryid" validate:"required"`
@@ -34,18 +33,18 @@ func (p *AppointmentServerClient) GetAvailability(w http.ResponseWriter, r *http
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":      "GetAvailability",
 		"categoryID":    reqbody.CategoryID,
 		"requestedTime": reqbody.RequestedDateTime,
 	}).Info("Processing availability check")
 
-	resp, err := p.CheckAvailability(context.Background(), &pb.GetAvailabilityRequest{
+	resp, err := p.CheckAvailability(r.Context(), &pb.GetAvailabilityRequest{
 		RequestedDateTime: timestamppb.New(reqbody.RequestedDateTime),
 		CategoryId:        int32(reqbody.CategoryID),
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetAvailability",
 			"error":    err.Error(),
 		}).Error("Failed to call availability service")
@@ -53,16 +52,15 @@ func (p *AppointmentServerClient) GetAvailability(w http.ResponseWriter, r *http
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetAvailability",
-		"response": resp,
 	}).Info("Availability fetched successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, r)
 }
 
 // GetAvailabilityByDoctorId handles availability check for a specific doctor
 func (p *AppointmentServerClient) GetAvailabilityByDoctorId(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to get availability by doctor ID")
+	p.Logger.WithContext(r.Context()).Info("Received request to get availability by doctor ID")
 
 	var reqbody struct {
 		DoctorId string `json:"doctorid" validate:"required"`
@@ -80,16 +78,16 @@ func (p *AppointmentServerClient) GetAvailabilityByDoctorId(w http.ResponseWrite
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetAvailabilityByDoctorId",
 		"doctorId": reqbody.DoctorId,
 	}).Info("Checking availability for doctor")
 
-	resp, err := p.CheckAvailabilityByDoctorId(context.Background(), &pb.CheckAvailabilityByDoctorIdRequest{
+	resp, err := p.CheckAvailabilityByDoctorId(r.Context(), &pb.CheckAvailabilityByDoctorIdRequest{
 		DoctorId: reqbody.DoctorId,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetAvailabilityByDoctorId",
 			"error":    err.Error(),
 		}).Error("Failed to call appointment service")
@@ -97,16 +95,15 @@ func (p *AppointmentServerClient) GetAvailabilityByDoctorId(w http.ResponseWrite
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetAvailabilityByDoctorId",
-		"response": resp,
 	}).Info("Doctor availability fetched successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, r)
 }
 
 // ConfirmPatientAppointment handles confirming a patient appointment
 func (p *AppointmentServerClient) ConfirmPatientAppointment(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to confirm patient appointment")
+	p.Logger.WithContext(r.Context()).Info("Received request to confirm patient appointment")
 
 	var reqbody struct {
 		SpecializationId int       `json:"specializationid" validate:"required"`
@@ -128,13 +125,12 @@ func (p *AppointmentServerClient) ConfirmPatientAppointment(w http.ResponseWrite
 
 	parsedTime := reqbody.AppointmentTime.UTC()
 
-	claims, err := middleware.ExtractClaimsFromCookie(r, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "ConfirmPatientAppointment",
-			"error":    err.Error(),
 		}).Error("Unauthorized access attempt")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, r)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, r)
 		return
 	}
 
@@ -146,15 +142,17 @@ func (p *AppointmentServerClient) ConfirmPatientAppointment(w http.ResponseWrite
 		Type:              reqbody.Type,
 	}
 
-	p.Logger.WithFields(logrus.Fields{
-		"function":  "ConfirmPatientAppointment",
-		"patientId": claims.UserId,
-		"request":   appointmentReq,
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"function":         "ConfirmPatientAppointment",
+		"patientId":        claims.UserId,
+		"doctorId":         appointmentReq.DoctorId,
+		"specializationId": appointmentReq.SpecializationId,
+		"type":             appointmentReq.Type,
 	}).Info("Confirming patient appointment")
 
-	resp, err := p.ConfirmAppointment(context.Background(), appointmentReq)
+	resp, err := p.ConfirmAppointment(r.Context(), appointmentReq)
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "ConfirmPatientAppointment",
 			"error":    err.Error(),
 		}).Error("Failed to call confirm appointment service")
@@ -162,9 +160,8 @@ func (p *AppointmentServerClient) ConfirmPatientAppointment(w http.ResponseWrite
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "ConfirmPatientAppointment",
-		"response": resp,
 	}).Info("Appointment confirmed successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, r)
 
@@ -186,30 +183,28 @@ func (p *AppointmentServerClient) CancelPatientAppointment(w http.ResponseWriter
 		return
 	}
 
-	claims, err := middleware.ExtractClaimsFromCookie(r, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "CancelAppointment",
-			"error":    err.Error(),
 		}).Error("Unauthorized access attempt")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, r)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, r)
 		return
 	}
-	resp, err := p.CancelAppointment(context.Background(), &pb.CancelAppointmentRequest{
+	resp, err := p.CancelAppointment(r.Context(), &pb.CancelAppointmentRequest{
 		PatientId:     claims.UserId,
 		AppointmentId: reqbody.AppointmentId,
 		Reason:        reqbody.Reason,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "CancelAppointment",
 			"error":    err.Error(),
 		}).Error("Failed to call cancel appointment service")
 		utils.JSONStandardResponse(w, "fail", "Failed to call service", "", http.StatusInternalServerError, r)
 	}
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "CancelAppointment",
-		"response": resp,
 	}).Info("Appointment cancelled successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, r)
 
@@ -217,23 +212,22 @@ func (p *AppointmentServerClient) CancelPatientAppointment(w http.ResponseWriter
 
 // GetAppointments handles fetching upcoming appointments for a patient
 func (p *AppointmentServerClient) GetAppointments(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to get upcoming appointments")
+	p.Logger.WithContext(r.Context()).Info("Received request to get upcoming appointments")
 
-	claims, err := middleware.ExtractClaimsFromCookie(r, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetAppointments",
-			"error":    err.Error(),
 		}).Error("Unauthorized access attempt")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, r)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, r)
 		return
 	}
 
-	resp, err := p.GetUpcomingAppointments(context.Background(), &pb.GetAppointmentsRequest{
+	resp, err := p.GetUpcomingAppointments(r.Context(), &pb.GetAppointmentsRequest{
 		PatientId: claims.UserId,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetAppointments",
 			"error":    err.Error(),
 		}).Error("Failed to retrieve appointments")
@@ -241,20 +235,19 @@ func (p *AppointmentServerClient) GetAppointments(w http.ResponseWriter, r *http
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetAppointments",
-		"response": resp,
 	}).Info("Upcoming appointments fetched successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, r)
 }
 
 // CreateRoomForVideoTreatments handles the creation of a video treatment room via gRPC
 func (d *AppointmentServerClient) CreateRoomForVideoTreatments(w http.ResponseWriter, req *http.Request) {
-	d.Logger.Info("Received request to create a video treatment room")
+	d.Logger.WithContext(req.Context()).Info("Received request to create a video treatment room")
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "doctor")
-	if err != nil {
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
@@ -262,7 +255,7 @@ func (d *AppointmentServerClient) CreateRoomForVideoTreatments(w http.ResponseWr
 		PatientId        string `json:"patientid" validate:"required"`
 		SpecializationId int64  `json:"specialization" validate:"required"`
 	}
-	err = json.NewDecoder(req.Body).Decode(&reqBody)
+	err := json.NewDecoder(req.Body).Decode(&reqBody)
 	if err != nil {
 		utils.JSONResponse(w, "Invalid request body", http.StatusBadRequest, req)
 		return
@@ -274,13 +267,13 @@ func (d *AppointmentServerClient) CreateRoomForVideoTreatments(w http.ResponseWr
 		return
 	}
 
-	resp, err := d.CreateRoomForVideoTreatment(context.Background(), &pb.VideoRoomRequest{
+	resp, err := d.CreateRoomForVideoTreatment(req.Context(), &pb.VideoRoomRequest{
 		PatientId:        reqBody.PatientId,
 		SpecializationId: reqBody.SpecializationId,
 		DoctorId:         claims.UserId,
 	})
 	if err != nil {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "CreateRoomForVideoTreatments",
 			"error":    err.Error(),
 		}).Error("Failed to create room for video treatment")
@@ -288,46 +281,43 @@ func (d *AppointmentServerClient) CreateRoomForVideoTreatments(w http.ResponseWr
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "CreateRoomForVideoTreatments",
-		"response": resp,
 	}).Info("Video treatment room created successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, req)
 }
 
 // VideoCallRender serves the video call HTML page for doctors
 func (d *AppointmentServerClient) VideoCallRender(w http.ResponseWriter, r *http.Request) {
-	d.Logger.Info("Serving video call page for doctor")
+	d.Logger.WithContext(r.Context()).Info("Serving video call page for doctor")
 
-	_, err := middleware.ExtractClaimsFromCookie(r, "doctor")
-	if err != nil {
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, r)
+	if _, ok := middleware.ClaimsFrom(r.Context()); !ok {
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, r)
 		return
 	}
 
 	videocallhtml := filepath.Join("templates", "video_call_jitsi.html")
 	http.ServeFile(w, r, videocallhtml)
-	d.Logger.Info("Video call page served successfully")
+	d.Logger.WithContext(r.Context()).Info("Video call page served successfully")
 }
 
 // Dashboard serves the admin dashboard HTML page
 func (d *AppointmentServerClient) Dashboard(w http.ResponseWriter, r *http.Request) {
-	d.Logger.Info("Serving admin dashboard")
+	d.Logger.WithContext(r.Context()).Info("Serving admin dashboard")
 
-	_, err := middleware.ExtractClaimsFromCookie(r, "admin")
-	if err != nil {
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, r)
+	if _, ok := middleware.ClaimsFrom(r.Context()); !ok {
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, r)
 		return
 	}
 
 	dashboardHTML := filepath.Join("templates", "dashboard.html")
 	http.ServeFile(w, r, dashboardHTML)
-	d.Logger.Info("Dashboard page served successfully")
+	d.Logger.WithContext(r.Context()).Info("Dashboard page served successfully")
 }
 
 // DashboardResponse fetches statistics details for the dashboard
 func (p *AppointmentServerClient) DashboardResponse(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Fetching dashboard statistics")
+	p.Logger.WithContext(r.Context()).Info("Fetching dashboard statistics")
 
 	filterParam := r.URL.Query().Get("filter")
 	if filterParam == "" {
@@ -335,11 +325,11 @@ func (p *AppointmentServerClient) DashboardResponse(w http.ResponseWriter, r *ht
 		return
 	}
 
-	resp, err := p.AppointmentServiceClient.FetchStatisticsDetails(context.Background(), &pb.StatisticsRequest{
+	resp, err := p.AppointmentServiceClient.FetchStatisticsDetails(r.Context(), &pb.StatisticsRequest{
 		Param: filterParam,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "DashboardResponse",
 			"error":    err.Error(),
 		}).Error("Failed to fetch dashboard stats")
@@ -353,15 +343,14 @@ func (p *AppointmentServerClient) DashboardResponse(w http.ResponseWriter, r *ht
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "DashboardResponse",
-		"response": resp,
 	}).Info("Dashboard statistics fetched successfully")
 }
 
 // AddDoctorSpecialization adds a new specialization for doctors via gRPC
 func (a *AppointmentServerClient) AddDoctorSpecialization(w http.ResponseWriter, req *http.Request) {
-	a.Logger.Info("Received request to add a new doctor specialization")
+	a.Logger.WithContext(req.Context()).Info("Received request to add a new doctor specialization")
 
 	var reqBody struct {
 		Name        string `json:"name" validate:"required"`
@@ -379,12 +368,12 @@ func (a *AppointmentServerClient) AddDoctorSpecialization(w http.ResponseWriter,
 		return
 	}
 
-	resp, err := a.AddSpecialization(context.Background(), &pb.AddSpecializationRequest{
+	resp, err := a.AddSpecialization(req.Context(), &pb.AddSpecializationRequest{
 		Name:        reqBody.Name,
 		Description: reqBody.Description,
 	})
 	if err != nil {
-		a.Logger.WithFields(logrus.Fields{
+		a.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "AddDoctorSpecialization",
 			"error":    err.Error(),
 		}).Error("Failed to add specialization")
@@ -392,9 +381,8 @@ func (a *AppointmentServerClient) AddDoctorSpecialization(w http.ResponseWriter,
 		return
 	}
 
-	a.Logger.WithFields(logrus.Fields{
+	a.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "AddDoctorSpecialization",
-		"response": resp,
 	}).Info("Doctor specialization added successfully")
 	utils.JSONResponse(w, resp, http.StatusOK, req)
 }
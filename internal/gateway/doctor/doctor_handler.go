@@ -16,7 +16,7 @@ import (
 const role = "doctor"
 
 func (d *DoctorServerClient) DoctorSignIn(w http.ResponseWriter, req *http.Request) {
-	d.Logger.Info("Received sign-in request")
+	d.Logger.WithContext(req.Context()).Info("Received sign-in request")
 
 	var reqBody struct {
 		Email    string `json:"email" validate:"required,email"`
@@ -35,12 +35,18 @@ func (d *DoctorServerClient) DoctorSignIn(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	resp, err := d.DoctorClient.SignIn(context.Background(), &doctor.SignInRequest{
+	attempt := middleware.BeginLogin(w, req, role, reqBody.Email)
+	if attempt == nil {
+		return
+	}
+
+	resp, err := d.DoctorClient.SignIn(req.Context(), &doctor.SignInRequest{
 		Email:    reqBody.Email,
 		Password: reqBody.Password,
 	})
 	if err != nil {
-		d.Logger.WithFields(logrus.Fields{
+		attempt.Failed(req.Context(), err)
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "DoctorSignIn",
 			"email":    reqBody.Email,
 			"error":    err.Error(),
@@ -49,29 +55,41 @@ func (d *DoctorServerClient) DoctorSignIn(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "DoctorSignIn",
 		"doctorId": resp.DoctorId,
 		"status":   resp.Status,
 	}).Info("Doctor signed in successfully")
 
-	if resp.Status == "success" {
-		jwtToken, err := middleware.CreateJWTToken(resp.DoctorId, role)
+	var result *middleware.SignInResult
+	if resp.Status != "success" {
+		attempt.Failed(req.Context(), nil)
+	} else {
+		attempt.Succeeded(req.Context())
+
+		// Set JWT and refresh tokens in cookies, or ask for the second factor
+		result, err = middleware.CompleteSignIn(w, req, resp.DoctorId, role)
 		if err != nil {
 			utils.JSONResponse(w, "Failed to create JWT token", http.StatusInternalServerError, req)
 			return
 		}
-
-		// Set JWT token in cookie
-		middleware.SetJWTToken(w, jwtToken, role)
-		d.Logger.Info("JWT token set in cookie for doctor")
+		d.Logger.WithContext(req.Context()).Info("JWT token set in cookie for doctor")
 	}
 
-	utils.JSONResponse(w, resp, http.StatusOK, req)
-	d.Logger.Info("Sign-in response sent")
+	utils.JSONResponse(w, struct {
+		*doctor.SignInResponse
+		*middleware.SignInResult
+	}{resp, result}, http.StatusOK, req)
+	d.Logger.WithContext(req.Context()).Info("Sign-in response sent")
 }
 
 func (d *DoctorServerClient) DoctorLogout(w http.ResponseWriter, r *http.Request) {
+	if err := middleware.EndSession(w, r, role); err != nil {
+		d.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "DoctorLogout",
+			"error":    err.Error(),
+		}).Error("Failed to revoke session")
+	}
 	http.SetCookie(w, &http.Cookie{
 		MaxAge:   -1,
 		Name:     "doctortoken",
@@ -82,35 +100,34 @@ func (d *DoctorServerClient) DoctorLogout(w http.ResponseWriter, r *http.Request
 		Path:     "/",
 	})
 
-	d.Logger.Info("Doctor logged out successfully")
+	d.Logger.WithContext(r.Context()).Info("Doctor logged out successfully")
 	utils.JSONStandardResponse(w, "success", "", "Doctor logged out successfully", http.StatusOK, r)
 }
 
 func (d *DoctorServerClient) GetDoctorProfile(w http.ResponseWriter, req *http.Request) {
-	d.Logger.Info("Received request to get doctor profile")
+	d.Logger.WithContext(req.Context()).Info("Received request to get doctor profile")
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "doctor")
-	if err != nil {
-		d.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "GetDoctorProfile",
-			"error":    err.Error(),
 		}).Error("Unauthorized access")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
 	doctorId := claims.UserId
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "GetDoctorProfile",
 		"doctorId": doctorId,
 	}).Info("Fetching profile for doctor ID")
 
 	// Call gRPC to fetch the profile
-	resp, err := d.DoctorClient.GetProfile(context.Background(), &doctor.GetProfileRequest{
+	resp, err := d.DoctorClient.GetProfile(req.Context(), &doctor.GetProfileRequest{
 		DoctorId: doctorId,
 	})
 	if err != nil || resp.Status != "success" {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "GetDoctorProfile",
 			"doctorId": doctorId,
 			"error":    err.Error(),
@@ -119,7 +136,7 @@ func (d *DoctorServerClient) GetDoctorProfile(w http.ResponseWriter, req *http.R
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "GetDoctorProfile",
 		"doctorId": doctorId,
 		"status":   resp.Status,
@@ -128,11 +145,11 @@ func (d *DoctorServerClient) GetDoctorProfile(w http.ResponseWriter, req *http.R
 	utils.JSONResponse(w, resp, http.StatusOK, req)
 }
 func (d *DoctorServerClient) UpdateDoctorProfile(w http.ResponseWriter, req *http.Request) {
-	d.Logger.Info("Received request to update doctor profile")
+	d.Logger.WithContext(req.Context()).Info("Received request to update doctor profile")
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "doctor")
-	if err != nil {
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
@@ -143,7 +160,7 @@ func (d *DoctorServerClient) UpdateDoctorProfile(w http.ResponseWriter, req *htt
 		SpecializationId int32  `json:"specialization"`
 		Phone            int    `json:"phone"`
 	}
-	err = json.NewDecoder(req.Body).Decode(&reqBody)
+	err := json.NewDecoder(req.Body).Decode(&reqBody)
 	if err != nil {
 		utils.JSONResponse(w, "Invalid request body", http.StatusBadRequest, req)
 		return
@@ -166,9 +183,9 @@ func (d *DoctorServerClient) UpdateDoctorProfile(w http.ResponseWriter, req *htt
 	}
 
 	// Call gRPC service to update the profile
-	resp, err := d.DoctorClient.UpdateProfile(context.Background(), updateReq)
+	resp, err := d.DoctorClient.UpdateProfile(req.Context(), updateReq)
 	if err != nil || resp.Status != "success" {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "UpdateDoctorProfile",
 			"doctorId": doctorId,
 			"error":    err.Error(),
@@ -177,7 +194,7 @@ func (d *DoctorServerClient) UpdateDoctorProfile(w http.ResponseWriter, req *htt
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "UpdateDoctorProfile",
 		"doctorId": doctorId,
 		"status":   resp.Status,
@@ -186,20 +203,20 @@ func (d *DoctorServerClient) UpdateDoctorProfile(w http.ResponseWriter, req *htt
 	utils.JSONResponse(w, resp, http.StatusOK, req)
 }
 
-func (d *DoctorServerClient) DoctorStoreAccessToken(email string, token *oauth2.Token) error {
-	d.Logger.WithFields(logrus.Fields{
+func (d *DoctorServerClient) DoctorStoreAccessToken(ctx context.Context, email string, token *oauth2.Token) error {
+	d.Logger.WithContext(ctx).WithFields(logrus.Fields{
 		"function": "DoctorStoreAccessToken",
 		"email":    email,
 	}).Info("Storing access token for doctor")
 
-	_, err := d.DoctorClient.StoreAccessToken(context.Background(), &doctor.StoreAccessTokenRequest{
+	_, err := d.DoctorClient.StoreAccessToken(ctx, &doctor.StoreAccessTokenRequest{
 		Email:        email,
 		AccessToken:  token.AccessToken,
 		RefreshToken: token.RefreshToken,
 		Expiry:       token.Expiry.String(),
 	})
 	if err != nil {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(ctx).WithFields(logrus.Fields{
 			"function": "DoctorStoreAccessToken",
 			"email":    email,
 			"error":    err.Error(),
@@ -207,7 +224,7 @@ func (d *DoctorServerClient) DoctorStoreAccessToken(email string, token *oauth2.
 		return err
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(ctx).WithFields(logrus.Fields{
 		"function": "DoctorStoreAccessToken",
 		"email":    email,
 	}).Info("Access token stored successfully")
@@ -215,11 +232,11 @@ func (d *DoctorServerClient) DoctorStoreAccessToken(email string, token *oauth2.
 }
 
 func (d *DoctorServerClient) ConfirmScheduleHandler(w http.ResponseWriter, req *http.Request) {
-	d.Logger.Info("Received request to confirm schedule")
+	d.Logger.WithContext(req.Context()).Info("Received request to confirm schedule")
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "doctor")
-	if err != nil {
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
@@ -229,7 +246,7 @@ func (d *DoctorServerClient) ConfirmScheduleHandler(w http.ResponseWriter, req *
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "ConfirmScheduleHandler",
 		"doctorId": doctorID,
 	}).Info("Making gRPC call to confirm schedule")
@@ -238,9 +255,9 @@ func (d *DoctorServerClient) ConfirmScheduleHandler(w http.ResponseWriter, req *
 		DoctorId: doctorID,
 	}
 
-	grpcResp, err := d.DoctorClient.ConfirmSchedule(context.Background(), grpcReq)
+	grpcResp, err := d.DoctorClient.ConfirmSchedule(req.Context(), grpcReq)
 	if err != nil {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "ConfirmScheduleHandler",
 			"doctorId": doctorID,
 			"error":    err.Error(),
@@ -250,7 +267,7 @@ func (d *DoctorServerClient) ConfirmScheduleHandler(w http.ResponseWriter, req *
 	}
 
 	if grpcResp.Status != "success" {
-		d.Logger.WithFields(logrus.Fields{
+		d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "ConfirmScheduleHandler",
 			"doctorId": doctorID,
 			"error":    grpcResp.Error,
@@ -259,7 +276,7 @@ func (d *DoctorServerClient) ConfirmScheduleHandler(w http.ResponseWriter, req *
 		return
 	}
 
-	d.Logger.WithFields(logrus.Fields{
+	d.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "ConfirmScheduleHandler",
 		"doctorId": doctorID,
 	}).Info("Schedule confirmed successfully")
@@ -1,11 +1,10 @@
 package doctor
 
 import (
-	"net/http"
-
 	pb "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/doctor"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
 
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/appointment"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/patient"
@@ -15,25 +14,33 @@ import (
 type DoctorServerClient struct {
 	DoctorClient pb.DoctorServiceClient
 	Logger       *logrus.Logger
+	OAuthConfig  *oauth2.Config
+
+	oauthStateKey []byte
 }
 
-func NewDoctorClient(doctorClient pb.DoctorServiceClient, logger *logrus.Logger) *DoctorServerClient {
+func NewDoctorClient(doctorClient pb.DoctorServiceClient, logger *logrus.Logger, oauthConfig *oauth2.Config, oauthStateSecret string) *DoctorServerClient {
 	return &DoctorServerClient{
-		DoctorClient: doctorClient,
-		Logger:       logger,
+		DoctorClient:  doctorClient,
+		Logger:        logger,
+		OAuthConfig:   oauthConfig,
+		oauthStateKey: newOAuthStateKey(oauthStateSecret),
 	}
 }
 func RegisterDoctorRoutes(router *mux.Router, DoctorClient *DoctorServerClient, PatientClient *patient.PatientServerClient, AppointmentClient *appointment.AppointmentServerClient) {
 	publicRouter := router.PathPrefix("/api/v1/doctor").Subrouter()
 	publicRouter.HandleFunc("/signin", DoctorClient.DoctorSignIn).Methods("POST")
 	publicRouter.HandleFunc("/logout", DoctorClient.DoctorLogout).Methods("POST")
-	publicRouter.HandleFunc("/auth/login", DoctorClient.HandleGoogleLogin).Methods("GET")
-	publicRouter.HandleFunc("/auth/callback", func(w http.ResponseWriter, r *http.Request) {
-		DoctorClient.HandleGoogleCallback(w, r)
-	}).Methods("GET")
+	publicRouter.HandleFunc("/token/refresh", middleware.RefreshHandler("doctor")).Methods("POST")
+	publicRouter.HandleFunc("/mfa/challenge", middleware.MFAChallengeHandler("doctor")).Methods("POST")
 
 	privateRouter := router.PathPrefix("/api/v1/doctor").Subrouter()
 	privateRouter.Use(middleware.JWTMiddleware("doctor"))
+	privateRouter.HandleFunc("/logout-all", middleware.LogoutEverywhereHandler("doctor")).Methods("POST")
+	privateRouter.HandleFunc("/mfa/enroll", middleware.MFAEnrollHandler("doctor")).Methods("POST")
+	privateRouter.HandleFunc("/mfa/verify", middleware.MFAVerifyHandler("doctor")).Methods("POST")
+	privateRouter.HandleFunc("/auth/login", DoctorClient.HandleGoogleLogin).Methods("GET")
+	privateRouter.HandleFunc("/auth/callback", DoctorClient.HandleGoogleCallback).Methods("GET")
 	privateRouter.HandleFunc("/profile", DoctorClient.GetDoctorProfile).Methods("GET")
 	privateRouter.HandleFunc("/profile", DoctorClient.UpdateDoctorProfile).Methods("PUT")
 	privateRouter.HandleFunc("/add-prescription", PatientClient.AddPrescriptionForPatient).Methods("POST")
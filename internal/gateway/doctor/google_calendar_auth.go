@@ -2,80 +2,243 @@ package doctor
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 
+	"github.com/NUHMANUDHEENT/hosp-connect-pb/proto/doctor"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
 )
 
-var (
-	googleOauthConfig *oauth2.Config
-	oauthStateString  = "random"
+const (
+	oauthStateCookie = "doctoroauth"
+	oauthStateTTL    = 10 * time.Minute
 )
 
 type GoogleUserInfo struct {
 	Email string `json:"email"`
 }
 
-// Initialize OAuth config for Google Calendar
-func init() {
-	fmt.Println(os.Getenv("CLIENT_ID"))
-	googleOauthConfig = &oauth2.Config{
-		ClientID:     os.Getenv("CLIENT_ID"),
-		ClientSecret: os.Getenv("CLIENT_SECRET"),
-		RedirectURL:  "https://hilofy.online/api/v1/doctor/auth/callback",
+// oauthState is what the login handler remembers about a pending authorization
+type oauthState struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	DoctorID string `json:"doctor_id"`
+	Expiry   int64  `json:"exp"`
+}
+
+// NewGoogleOAuthConfig builds the OAuth client doctors link Google Calendar with
+func NewGoogleOAuthConfig(clientID, clientSecret, redirectURL string) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
 		Scopes:       []string{calendar.CalendarScope, "https://www.googleapis.com/auth/userinfo.email"},
 		Endpoint:     google.Endpoint,
 	}
 }
 
+// newOAuthStateKey returns the key that signs the state cookie. Without a
+// configured secret, which only development mode allows, a random key is
+// used and the state only verifies on the instance that issued it.
+func newOAuthStateKey(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func randomState() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (d *DoctorServerClient) signOAuthState(state oauthState) (string, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, d.oauthStateKey)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func (d *DoctorServerClient) verifyOAuthState(value string) (*oauthState, error) {
+	parts := strings.SplitN(value, ".", 2)
+	if len(parts) != 2 {
+		return nil, errors.New("malformed state cookie")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed state cookie")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed state cookie")
+	}
+	mac := hmac.New(sha256.New, d.oauthStateKey)
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errors.New("invalid state cookie signature")
+	}
+	var state oauthState
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return nil, errors.New("malformed state cookie")
+	}
+	if time.Now().Unix() > state.Expiry {
+		return nil, errors.New("state cookie expired")
+	}
+	return &state, nil
+}
+
+func clearOAuthStateCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/api/v1/doctor/auth",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
 // Doctor clicks login
 func (d *DoctorServerClient) HandleGoogleLogin(w http.ResponseWriter, r *http.Request) {
-	url := googleOauthConfig.AuthCodeURL(oauthStateString)
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	state, err := randomState()
+	if err != nil {
+		http.Error(w, "Failed to start Google login", http.StatusInternalServerError)
+		return
+	}
+	verifier := oauth2.GenerateVerifier()
+	cookie, err := d.signOAuthState(oauthState{
+		State:    state,
+		Verifier: verifier,
+		DoctorID: claims.UserId,
+		Expiry:   time.Now().Add(oauthStateTTL).Unix(),
+	})
+	if err != nil {
+		http.Error(w, "Failed to start Google login", http.StatusInternalServerError)
+		return
+	}
+
+	// Lax so the cookie comes back on the top-level redirect from Google
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    cookie,
+		Path:     "/api/v1/doctor/auth",
+		MaxAge:   int(oauthStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	url := d.OAuthConfig.AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
 // Callback from Google after doctor login
 func (d *DoctorServerClient) HandleGoogleCallback(w http.ResponseWriter, r *http.Request) {
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookie)
+	if err != nil {
+		http.Error(w, "Missing state", http.StatusBadRequest)
+		return
+	}
+	// The state is single use whatever the outcome
+	clearOAuthStateCookie(w)
+
+	pending, err := d.verifyOAuthState(cookie.Value)
+	if err != nil {
+		d.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "HandleGoogleCallback",
+			"doctorId": claims.UserId,
+			"error":    err.Error(),
+		}).Warn("Rejected Google callback")
+		http.Error(w, "Invalid state", http.StatusBadRequest)
+		return
+	}
 	state := r.FormValue("state")
-	if state != oauthStateString {
+	if subtle.ConstantTimeCompare([]byte(state), []byte(pending.State)) != 1 || pending.DoctorID != claims.UserId {
 		http.Error(w, "Invalid state", http.StatusBadRequest)
 		return
 	}
 
 	code := r.FormValue("code")
-	token, err := googleOauthConfig.Exchange(context.Background(), code)
+	token, err := d.OAuthConfig.Exchange(r.Context(), code, oauth2.VerifierOption(pending.Verifier))
 	if err != nil {
 		http.Error(w, "Failed to exchange token", http.StatusInternalServerError)
 		return
 	}
 
 	// Get the user's email from Google User Info API
-	email, err := getGoogleUserEmail(token)
+	googleEmail, err := d.getGoogleUserEmail(r.Context(), token)
 	if err != nil {
 		http.Error(w, "Failed to get user info", http.StatusInternalServerError)
 		return
 	}
 
-	// Store the token with the email instead of doctor_id
-	err = d.DoctorStoreAccessToken(email, token)
+	// The doctor service keys calendar tokens by email, so link the token to
+	// the signed-in doctor's own account rather than the Google address
+	profile, err := d.DoctorClient.GetProfile(r.Context(), &doctor.GetProfileRequest{
+		DoctorId: claims.UserId,
+	})
+	if err != nil || profile.Status != "success" || profile.Email == "" {
+		http.Error(w, "Failed to load doctor profile", http.StatusInternalServerError)
+		return
+	}
+
+	err = d.DoctorStoreAccessToken(r.Context(), profile.Email, token)
 	if err != nil {
 		http.Error(w, "Failed to store token", http.StatusInternalServerError)
 		return
 	}
 
+	d.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"function":    "HandleGoogleCallback",
+		"doctorId":    claims.UserId,
+		"googleEmail": googleEmail,
+	}).Info("Linked Google Calendar to doctor")
+
 	// Success! You can redirect to the next page or dashboard
-	fmt.Fprintf(w, "Google Calendar authenticated successfully for email: %s", email)
+	fmt.Fprintf(w, "Google Calendar %s linked successfully", googleEmail)
 }
 
 // Helper function to retrieve the user's email using the OAuth2 token
-func getGoogleUserEmail(token *oauth2.Token) (string, error) {
-	client := googleOauthConfig.Client(context.Background(), token)
+func (d *DoctorServerClient) getGoogleUserEmail(ctx context.Context, token *oauth2.Token) (string, error) {
+	client := d.OAuthConfig.Client(ctx, token)
 
 	// Request user info from Google's userinfo endpoint
 	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
@@ -0,0 +1,237 @@
+// Package gateway wires the configuration, the upstream connections and the
+// HTTP routes of the services together
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	pbAdmin "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/admin"
+	pbAppointment "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/appointment"
+	pbDoctor "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/doctor"
+	pbPatient "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/patient"
+	pbPayment "github.com/NUHMANUDHEENT/hosp-connect-pb/proto/payment"
+	"github.com/gorilla/mux"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/audit"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/admin"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/appointment"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/doctor"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/patient"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/gateway/payment"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/upstream"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/logs"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+)
+
+// Gateway is the assembled router and the upstream connections behind it
+type Gateway struct {
+	Router      *mux.Router
+	Logger      *logrus.Logger
+	User        *upstream.Conn
+	Appointment *upstream.Conn
+	Payment     *upstream.Conn
+	Health      *upstream.HealthChecker
+	// Audit is nil when auditing is off
+	Audit *audit.Trail
+
+	stopWatchers context.CancelFunc
+}
+
+// Close closes the upstream connections in the reverse order they were
+// opened. Call it after the HTTP server has drained.
+func (g *Gateway) Close() {
+	g.stopWatchers()
+	for _, conn := range []*upstream.Conn{g.Payment, g.Appointment, g.User} {
+		conn.Close()
+		log.Printf("Closed %s service connection", conn.Name)
+	}
+	if g.Audit != nil {
+		audit.Use(nil)
+		if err := g.Audit.Close(); err != nil {
+			log.Println("Failed to close the audit trail:", err)
+		}
+	}
+}
+
+func GrpcSetUp(rt *config.Runtime) *Gateway {
+	cfg := rt.Current().Config
+
+	// Certificate watchers and health checks run until the gateway is closed
+	ctx, stopWatchers := context.WithCancel(context.Background())
+	userBreaker := upstream.NewBreaker("user", cfg.Upstreams.User.Breaker)
+	appointmentBreaker := upstream.NewBreaker("appointment", cfg.Upstreams.Appointment.Breaker)
+	paymentBreaker := upstream.NewBreaker("payment", cfg.Upstreams.Payment.Breaker)
+	userConn := dialUpstream(ctx, rt, "user", cfg.Upstreams.User, userBreaker)
+	appointmentConn := dialUpstream(ctx, rt, "appointment", cfg.Upstreams.Appointment, appointmentBreaker)
+	paymentConn := dialUpstream(ctx, rt, "payment", cfg.Upstreams.Payment, paymentBreaker)
+
+	logger := logs.NewLogger()
+	level, _ := logrus.ParseLevel(cfg.Log.Level)
+	logger.SetLevel(level)
+	redact := logs.NewRedactHook(cfg.Log.Redact)
+	logger.AddHook(redact)
+
+	rt.OnReload(func(next *config.Config) (config.Change, error) {
+		var changes []config.Change
+		discard := func() {
+			for _, change := range changes {
+				if change.Discard != nil {
+					change.Discard()
+				}
+			}
+		}
+		for _, u := range []struct {
+			conn   *upstream.Conn
+			target string
+		}{
+			{userConn, upstream.DialTarget(next.Upstreams.User)},
+			{appointmentConn, upstream.DialTarget(next.Upstreams.Appointment)},
+			{paymentConn, upstream.DialTarget(next.Upstreams.Payment)},
+		} {
+			change, err := u.conn.Retarget(u.target)
+			if err != nil {
+				discard()
+				return config.Change{}, fmt.Errorf("upstream %s: %v", u.conn.Name, err)
+			}
+			changes = append(changes, change)
+		}
+		return config.Change{
+			Commit: func() {
+				for _, change := range changes {
+					if change.Commit != nil {
+						change.Commit()
+					}
+				}
+			},
+			Discard: discard,
+		}, nil
+	})
+	rt.OnReload(func(next *config.Config) (config.Change, error) {
+		return config.Change{Commit: func() {
+			userBreaker.Configure(next.Upstreams.User.Breaker)
+			appointmentBreaker.Configure(next.Upstreams.Appointment.Breaker)
+			paymentBreaker.Configure(next.Upstreams.Payment.Breaker)
+		}}, nil
+	})
+	rt.OnReload(func(next *config.Config) (config.Change, error) {
+		level, err := logrus.ParseLevel(next.Log.Level)
+		if err != nil {
+			return config.Change{}, err
+		}
+		return config.Change{Commit: func() {
+			logger.SetLevel(level)
+			redact.Configure(next.Log.Redact)
+		}}, nil
+	})
+
+	trail, err := openAudit(cfg.Audit, logger)
+	if err != nil {
+		log.Fatalf("Failed to open the audit trail: %v", err)
+	}
+	audit.Use(trail)
+
+	health := upstream.NewHealthChecker(rt, userConn, appointmentConn, paymentConn)
+	go health.Run(ctx)
+
+	router := mux.NewRouter()
+	router.Use(upstream.DeadlineMiddleware(rt), upstream.BreakerMiddleware)
+	router.HandleFunc("/healthz", health.LivenessHandler).Methods("GET", "HEAD")
+	router.HandleFunc("/readyz", health.ReadinessHandler).Methods("GET", "HEAD")
+	router.Handle("/api/v1/admin/health", middleware.JWTMiddleware("admin")(
+		middleware.RequirePermission("health:read")(http.HandlerFunc(health.StatusHandler)))).Methods("GET")
+	if trail != nil {
+		router.Handle("/api/v1/admin/audit", middleware.JWTMiddleware("admin")(
+			middleware.RequirePermission("audit:read")(http.HandlerFunc(trail.QueryHandler)))).Methods("GET")
+	}
+	router.Handle("/metrics", promhttp.Handler())
+	router.HandleFunc("/.well-known/jwks.json", middleware.JWKSHandler).Methods("GET")
+	router.HandleFunc("/.well-known/openid-configuration", middleware.OpenIDConfigurationHandler).Methods("GET")
+	router.Handle("/api/v1/admin/config", middleware.JWTMiddleware("admin")(
+		middleware.RequirePermission("config:read")(configHandler(rt)))).Methods("GET")
+	adminClient := admin.NewAdminClient(pbAdmin.NewAdminServiceClient(userConn), logger)
+	oauthConfig := doctor.NewGoogleOAuthConfig(cfg.Google.ClientID, cfg.Google.ClientSecret, cfg.Google.RedirectURL)
+	doctorClient := doctor.NewDoctorClient(pbDoctor.NewDoctorServiceClient(userConn), logger, oauthConfig, cfg.Google.StateSecret)
+	patientClient := patient.NewPatientClient(pbPatient.NewPatientServiceClient(userConn), logger)
+	appointmentClient := appointment.NewAppointmentClient(pbAppointment.NewAppointmentServiceClient(appointmentConn), logger)
+	paymentClient := payment.NewPaymentClient(pbPayment.NewPaymentServiceClient(paymentConn), logger)
+	// Validate already checked the credentials
+	dialogFlowCredentials, _ := cfg.DialogFlow.Credentials()
+	helpDesk := di.NewDialogFlowClient(dialogFlowCredentials, cfg.DialogFlow.ProjectID)
+
+	admin.RegisterAdminRoutes(router, adminClient, appointmentClient)
+	doctor.RegisterDoctorRoutes(router, doctorClient, patientClient, appointmentClient)
+	patient.RegisterPatientRoutes(router, patientClient, appointmentClient, helpDesk)
+	payment.RegisterPaymentRouters(router, paymentClient)
+	return &Gateway{
+		Router:      router,
+		Logger:      logger,
+		User:        userConn,
+		Appointment: appointmentConn,
+		Payment:     paymentConn,
+		Health:      health,
+		Audit:       trail,
+
+		stopWatchers: stopWatchers,
+	}
+}
+
+// dialUpstream connects to one backend and exits when its transport settings
+// cannot be used, so a bad certificate fails the start instead of every call
+func dialUpstream(ctx context.Context, rt *config.Runtime, name string, target config.UpstreamTarget, breaker *upstream.Breaker) *upstream.Conn {
+	options, err := upstream.DialOptions(ctx, target.TLS)
+	if err != nil {
+		log.Fatalf("Failed to set up TLS for %s service: %v", name, err)
+	}
+	options = append(options,
+		grpc.WithDefaultServiceConfig(upstream.ServiceConfig(target, rt.Current().Config.Retries)),
+		grpc.WithChainUnaryInterceptor(di.UpstreamMetrics(name), di.UpstreamRequestID(), upstream.DeadlineInterceptor(rt), breaker.UnaryInterceptor()),
+		// Every call gets a client span and carries the trace context to the upstream
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+	)
+	conn, err := upstream.Dial(name, upstream.DialTarget(target), options...)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s service: %v", name, err)
+	}
+	if mode := target.TLS.Mode; mode != "" && mode != config.UpstreamPlaintext {
+		log.Printf("Connecting to %s service at %s over %s", name, upstream.DialTarget(target), mode)
+	}
+	return conn
+}
+
+// openAudit opens the audit trail, nil when auditing is off
+func openAudit(a config.AuditConfig, logger *logrus.Logger) (*audit.Trail, error) {
+	if a.Sink == config.AuditNone {
+		return nil, nil
+	}
+	sink, err := audit.NewFileSink(a.File, logger)
+	if err != nil {
+		return nil, err
+	}
+	trail, err := audit.New(sink, logger)
+	if err != nil {
+		sink.Close()
+		return nil, err
+	}
+	return trail, nil
+}
+
+// configHandler shows the active configuration version with secrets redacted
+func configHandler(rt *config.Runtime) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		snapshot := rt.Current()
+		utils.JSONResponse(w, config.Snapshot{
+			Version:  snapshot.Version,
+			LoadedAt: snapshot.LoadedAt,
+			Config:   snapshot.Config.Redacted(),
+		}, http.StatusOK, r)
+	})
+}
@@ -1,7 +1,6 @@
 package patient
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -10,6 +9,7 @@ import (
 
 	"github.com/NUHMANUDHEENT/hosp-connect-pb/proto/patient"
 	"github.com/gorilla/websocket"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/audit"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/middleware"
@@ -18,7 +18,7 @@ import (
 
 // PatientSignUp handles the patient signup via gRPC
 func (p *PatientServerClient) PatientSignUp(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received patient signup request")
+	p.Logger.WithContext(req.Context()).Info("Received patient signup request")
 
 	var reqBody struct {
 		Email    string `json:"email" validate:"required,email"`
@@ -35,7 +35,7 @@ func (p *PatientServerClient) PatientSignUp(w http.ResponseWriter, req *http.Req
 	}
 
 	// Call the gRPC service
-	resp, err := p.PatientClient.SignUp(context.Background(), &patient.SignUpRequest{
+	resp, err := p.PatientClient.SignUp(req.Context(), &patient.SignUpRequest{
 		Email:    reqBody.Email,
 		Password: reqBody.Password,
 		Name:     reqBody.Name,
@@ -44,7 +44,7 @@ func (p *PatientServerClient) PatientSignUp(w http.ResponseWriter, req *http.Req
 		Gender:   reqBody.Gender,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "PatientSignUp",
 			"email":    reqBody.Email,
 			"error":    err.Error(),
@@ -53,7 +53,7 @@ func (p *PatientServerClient) PatientSignUp(w http.ResponseWriter, req *http.Req
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function":  "PatientSignUp",
 		"patientId": resp.Message,
 		"status":    resp.Status,
@@ -61,34 +61,33 @@ func (p *PatientServerClient) PatientSignUp(w http.ResponseWriter, req *http.Req
 
 	// Return a success response
 	utils.JSONResponse(w, resp, int(resp.StatusCode), req)
-	p.Logger.Info("Signup response sent")
+	p.Logger.WithContext(req.Context()).Info("Signup response sent")
 }
 
 // SignUpVerify verifies the patient signup token
 func (p *PatientServerClient) SignUpVerify(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received signup verification request")
+	p.Logger.WithContext(req.Context()).Info("Received signup verification request")
 
 	token := req.URL.Query().Get("token")
 	if token == "" {
-		p.Logger.Warn("Invalid token provided for signup verification")
+		p.Logger.WithContext(req.Context()).Warn("Invalid token provided for signup verification")
 		utils.JSONResponse(w, "Invalid token", http.StatusBadRequest, req)
 		return
 	}
 
-	resp, err := p.PatientClient.SignUpVerify(context.Background(), &patient.SignUpVerifyRequest{
+	resp, err := p.PatientClient.SignUpVerify(req.Context(), &patient.SignUpVerifyRequest{
 		Token: token,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "SignUpVerify",
-			"token":    token,
 			"error":    err.Error(),
 		}).Error("gRPC error during signup verification")
 		utils.JSONResponse(w, "Failed to verify token", http.StatusInternalServerError, req)
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function": "SignUpVerify",
 		"status":   resp.Status,
 	}).Info("Signup verification successful")
@@ -97,7 +96,7 @@ func (p *PatientServerClient) SignUpVerify(w http.ResponseWriter, req *http.Requ
 
 // PatientSignIn handles the patient sign-in via gRPC
 func (p *PatientServerClient) PatientSignIn(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received patient sign-in request")
+	p.Logger.WithContext(req.Context()).Info("Received patient sign-in request")
 
 	var reqBody struct {
 		Email    string `json:"email" validate:"required,email"`
@@ -105,7 +104,7 @@ func (p *PatientServerClient) PatientSignIn(w http.ResponseWriter, req *http.Req
 	}
 	err := json.NewDecoder(req.Body).Decode(&reqBody)
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "PatientSignIn",
 			"error":    err.Error(),
 		}).Error("Failed to decode request body")
@@ -113,13 +112,19 @@ func (p *PatientServerClient) PatientSignIn(w http.ResponseWriter, req *http.Req
 		return
 	}
 
+	attempt := middleware.BeginLogin(w, req, "patient", reqBody.Email)
+	if attempt == nil {
+		return
+	}
+
 	// Call the gRPC service
-	resp, err := p.PatientClient.SignIn(context.Background(), &patient.SignInRequest{
+	resp, err := p.PatientClient.SignIn(req.Context(), &patient.SignInRequest{
 		Email:    reqBody.Email,
 		Password: reqBody.Password,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		attempt.Failed(req.Context(), err)
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "PatientSignIn",
 			"email":    reqBody.Email,
 			"error":    err.Error(),
@@ -128,17 +133,22 @@ func (p *PatientServerClient) PatientSignIn(w http.ResponseWriter, req *http.Req
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function":  "PatientSignIn",
 		"patientId": resp.PatientId,
 		"status":    resp.Status,
 	}).Info("Patient signed in successfully")
 
-	if resp.Status == "success" {
-		// Create JWT token
-		jwtToken, err := middleware.CreateJWTToken(resp.PatientId, "patient")
+	var tokens *middleware.TokenResponse
+	if resp.Status != "success" {
+		attempt.Failed(req.Context(), nil)
+	} else {
+		attempt.Succeeded(req.Context())
+
+		// Create JWT and refresh tokens and set them in cookies
+		tokens, err = middleware.IssueSession(w, req, resp.PatientId, "patient")
 		if err != nil {
-			p.Logger.WithFields(logrus.Fields{
+			p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 				"function":  "PatientSignIn",
 				"patientId": resp.PatientId,
 				"error":     err.Error(),
@@ -147,19 +157,27 @@ func (p *PatientServerClient) PatientSignIn(w http.ResponseWriter, req *http.Req
 			return
 		}
 
-		// Set JWT token in cookie
-		middleware.SetJWTToken(w, jwtToken, "patient")
-		p.Logger.Info("JWT token set in cookie for patient")
+		p.Logger.WithContext(req.Context()).Info("JWT token set in cookie for patient")
 	}
 
-	// Return a success response with JWT token
-	utils.JSONResponse(w, resp, int(resp.StatusCode), req)
-	p.Logger.Info("Sign-in response sent")
+	// Return a success response, with the tokens when the client asked for them
+	utils.JSONResponse(w, struct {
+		*patient.SignInResponse
+		*middleware.TokenResponse
+	}{resp, tokens}, int(resp.StatusCode), req)
+	p.Logger.WithContext(req.Context()).Info("Sign-in response sent")
 }
 
 // PatientLogout handles patient logout
 func (p *PatientServerClient) PatientLogout(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received patient logout request")
+	p.Logger.WithContext(req.Context()).Info("Received patient logout request")
+
+	if err := middleware.EndSession(w, req, "patient"); err != nil {
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
+			"function": "PatientLogout",
+			"error":    err.Error(),
+		}).Error("Failed to revoke session")
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		MaxAge:   -1,
@@ -172,28 +190,27 @@ func (p *PatientServerClient) PatientLogout(w http.ResponseWriter, req *http.Req
 	})
 
 	utils.JSONStandardResponse(w, "success", "", "Patient logged out successfully", http.StatusOK, req)
-	p.Logger.Info("Patient logged out successfully")
+	p.Logger.WithContext(req.Context()).Info("Patient logged out successfully")
 }
 
 // GetPatientProfile retrieves the patient profile
 func (p *PatientServerClient) GetPatientProfile(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received request to get patient profile")
+	p.Logger.WithContext(req.Context()).Info("Received request to get patient profile")
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "GetPatientProfile",
-			"error":    err.Error(),
 		}).Error("Unauthorized access")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
-	resp, err := p.PatientClient.GetProfile(context.Background(), &patient.GetProfileRequest{
+	resp, err := p.PatientClient.GetProfile(req.Context(), &patient.GetProfileRequest{
 		PatientId: claims.UserId,
 	})
 	if err != nil || resp.Status != "success" {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "GetPatientProfile",
 			"error":    err.Error(),
 		}).Error("Failed to get profile")
@@ -201,7 +218,7 @@ func (p *PatientServerClient) GetPatientProfile(w http.ResponseWriter, req *http
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function":  "GetPatientProfile",
 		"patientId": claims.UserId,
 	}).Info("Successfully retrieved patient profile")
@@ -209,7 +226,7 @@ func (p *PatientServerClient) GetPatientProfile(w http.ResponseWriter, req *http
 }
 
 func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *http.Request) {
-	p.Logger.Info("Received request to update patient profile")
+	p.Logger.WithContext(req.Context()).Info("Received request to update patient profile")
 
 	var reqBody struct {
 		PatientID string `json:"patient_id" validate:"required"`
@@ -220,19 +237,18 @@ func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *h
 		Gender    string `json:"gender" validate:"required,oneof=male female other"`
 	}
 
-	claims, err := middleware.ExtractClaimsFromCookie(req, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(req.Context())
+	if !ok {
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "UpdatePatientProfile",
-			"error":    err.Error(),
 		}).Error("Unauthorized access")
-		utils.JSONResponse(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized, req)
+		utils.JSONResponse(w, "Unauthorized", http.StatusUnauthorized, req)
 		return
 	}
 
-	err = json.NewDecoder(req.Body).Decode(&reqBody)
+	err := json.NewDecoder(req.Body).Decode(&reqBody)
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function": "UpdatePatientProfile",
 			"error":    err.Error(),
 		}).Error("Failed to decode request body")
@@ -240,7 +256,7 @@ func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *h
 		return
 	}
 
-	resp, err := p.PatientClient.UpdateProfile(context.Background(), &patient.UpdateProfileRequest{
+	resp, err := p.PatientClient.UpdateProfile(req.Context(), &patient.UpdateProfileRequest{
 		Patient: &patient.Patient{
 			PatientId: claims.UserId,
 			Name:      reqBody.Name,
@@ -251,7 +267,7 @@ func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *h
 		},
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 			"function":  "UpdatePatientProfile",
 			"patientId": claims.UserId,
 			"error":     err.Error(),
@@ -260,7 +276,7 @@ func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *h
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(req.Context()).WithFields(logrus.Fields{
 		"function":  "UpdatePatientProfile",
 		"patientId": claims.UserId,
 	}).Info("Patient profile updated successfully")
@@ -269,7 +285,7 @@ func (p *PatientServerClient) UpdatePatientProfile(w http.ResponseWriter, req *h
 }
 
 func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to add prescription for patient")
+	p.Logger.WithContext(r.Context()).Info("Received request to add prescription for patient")
 
 	var reqBody struct {
 		PatientId    string `json:"patientid" validate:"required"`
@@ -281,7 +297,7 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "AddPrescriptionForPatient",
 			"error":    err.Error(),
 		}).Error("Failed to bind JSON")
@@ -289,9 +305,9 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 		return
 	}
 
-	claims, err := middleware.ExtractClaimsFromCookie(r, "doctor")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "AddPrescriptionForPatient",
 			"error":    "Unauthorized",
 		}).Error("Unauthorized access")
@@ -301,7 +317,7 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 
 	doctorId := claims.UserId
 	if doctorId == "" {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "AddPrescriptionForPatient",
 			"error":    "Unauthorized - missing doctor ID",
 		}).Error("Unauthorized access")
@@ -318,13 +334,14 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 		})
 	}
 
-	resp, err := p.PatientClient.AddPrescription(context.Background(), &patient.AddPrescriptionRequest{
+	resp, err := p.PatientClient.AddPrescription(r.Context(), &patient.AddPrescriptionRequest{
 		PatientId:    reqBody.PatientId,
 		DoctorId:     doctorId,
 		Prescription: prescription,
 	})
+	audit.Log(r.Context(), audit.ActionPrescriptionAdd, reqBody.PatientId, audit.OutcomeOf(err, resp.GetStatusCode()))
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function":  "AddPrescriptionForPatient",
 			"patientId": reqBody.PatientId,
 			"error":     err.Error(),
@@ -333,7 +350,7 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":  "AddPrescriptionForPatient",
 		"patientId": reqBody.PatientId,
 	}).Info("Prescription added successfully")
@@ -342,31 +359,30 @@ func (p *PatientServerClient) AddPrescriptionForPatient(w http.ResponseWriter, r
 }
 
 func (p *PatientServerClient) GetPrescriptions(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to get prescriptions")
+	p.Logger.WithContext(r.Context()).Info("Received request to get prescriptions")
 
 	val := r.URL.Query()
 	query := val.Get("query")
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetPrescriptions",
 		"query":    query,
 	}).Info("Fetching prescriptions with query")
 
-	claims, err := middleware.ExtractClaimsFromCookie(r, "patient")
-	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetPrescriptions",
-			"error":    err.Error(),
 		}).Error("Unauthorized access")
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	resp, err := p.PatientClient.GetPrescription(context.Background(), &patient.GetPrescriptionRequest{
+	resp, err := p.PatientClient.GetPrescription(r.Context(), &patient.GetPrescriptionRequest{
 		PatientId: claims.UserId,
 		Query:     query,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function":  "GetPrescriptions",
 			"patientId": claims.UserId,
 			"error":     err.Error(),
@@ -375,7 +391,7 @@ func (p *PatientServerClient) GetPrescriptions(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":  "GetPrescriptions",
 		"patientId": claims.UserId,
 	}).Info("Fetched prescriptions successfully")
@@ -384,11 +400,11 @@ func (p *PatientServerClient) GetPrescriptions(w http.ResponseWriter, r *http.Re
 }
 
 func (p *PatientServerClient) GetPrescriptionsForDoctors(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Received request to get prescriptions for doctor")
+	p.Logger.WithContext(r.Context()).Info("Received request to get prescriptions for doctor")
 
 	val := r.URL.Query()
 	query := val.Get("query")
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function": "GetPrescriptionsForDoctors",
 		"query":    query,
 	}).Info("Fetching prescriptions for doctor with query")
@@ -398,7 +414,7 @@ func (p *PatientServerClient) GetPrescriptionsForDoctors(w http.ResponseWriter,
 	}
 	err := json.NewDecoder(r.Body).Decode(&reqBody)
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "GetPrescriptionsForDoctors",
 			"error":    err.Error(),
 		}).Error("Invalid request format")
@@ -406,12 +422,12 @@ func (p *PatientServerClient) GetPrescriptionsForDoctors(w http.ResponseWriter,
 		return
 	}
 
-	resp, err := p.PatientClient.GetPrescription(context.Background(), &patient.GetPrescriptionRequest{
+	resp, err := p.PatientClient.GetPrescription(r.Context(), &patient.GetPrescriptionRequest{
 		PatientId: reqBody.Patient_Id,
 		Query:     query,
 	})
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function":  "GetPrescriptionsForDoctors",
 			"patientId": reqBody.Patient_Id,
 			"error":     err.Error(),
@@ -420,7 +436,7 @@ func (p *PatientServerClient) GetPrescriptionsForDoctors(w http.ResponseWriter,
 		return
 	}
 
-	p.Logger.WithFields(logrus.Fields{
+	p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 		"function":  "GetPrescriptionsForDoctors",
 		"patientId": reqBody.Patient_Id,
 	}).Info("Fetched prescriptions for doctor successfully")
@@ -429,42 +445,59 @@ func (p *PatientServerClient) GetPrescriptionsForDoctors(w http.ResponseWriter,
 }
 
 func (d *PatientServerClient) VideoCallRender(w http.ResponseWriter, r *http.Request) {
-	d.Logger.Info("Serving video call HTML page")
+	d.Logger.WithContext(r.Context()).Info("Serving video call HTML page")
 	videocallhtml := filepath.Join("templates", "video_call_jitsi.html")
 	http.ServeFile(w, r, videocallhtml)
-	d.Logger.Info("Video call HTML page served successfully")
+	d.Logger.WithContext(r.Context()).Info("Video call HTML page served successfully")
 }
 
 func (p *PatientServerClient) PatientChatHandler(w http.ResponseWriter, r *http.Request) {
-	p.Logger.Info("Patient chat connection request received")
+	p.Logger.WithContext(r.Context()).Info("Patient chat connection request received")
+
+	claims, ok := middleware.ClaimsFrom(r.Context())
+	if !ok {
+		utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+		return
+	}
 
 	conn, err := di.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		p.Logger.WithFields(logrus.Fields{
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 			"function": "PatientChatHandler",
 			"error":    err.Error(),
 		}).Error("Error upgrading patient connection")
 		return
 	}
-	di.PatientConnections[conn] = true
-	defer conn.Close()
+	if !di.PatientConnections.Add(conn) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		conn.Close()
+		return
+	}
+	defer func() {
+		di.PatientConnections.Remove(conn)
+		conn.Close()
+	}()
 
 	for {
 		var message di.Message
 		err := conn.ReadJSON(&message)
 		if err != nil {
-			p.Logger.WithFields(logrus.Fields{
+			p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
 				"function": "PatientChatHandler",
 				"error":    err.Error(),
 			}).Error("Error reading message from patient")
-			delete(di.PatientConnections, conn)
 			break
 		}
-		p.Logger.WithFields(logrus.Fields{
-			"function": "PatientChatHandler",
-			"message":  message,
+		p.Logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function":  "PatientChatHandler",
+			"patientId": claims.UserId,
 		}).Info("Received message from patient")
 
+		// Customer care replies by patient id, which comes from the token and
+		// not from what the client claims to be
+		message.Username = claims.UserId
+		message.Sender = "patient"
+
 		sendMessageToCustomerCare(message) // Implement this function to handle sending messages
 	}
 }
@@ -475,13 +508,8 @@ func sendMessageToCustomerCare(msg di.Message) {
 		log.Println("Error marshalling message to JSON:", err)
 		return
 	}
-	for conn := range di.CustomerConnections {
-		err := conn.WriteMessage(websocket.TextMessage, messageJSON)
-		if err != nil {
-			log.Println("Error sending message to customer care:", err)
-			conn.Close()
-			delete(di.CustomerConnections, conn)
-		}
+	if err := di.CustomerConnections.Broadcast(messageJSON); err != nil {
+		log.Println("Error sending message to customer care:", err)
 	}
 }
 func (p *PatientServerClient) PatientChatRender(w http.ResponseWriter, r *http.Request) {
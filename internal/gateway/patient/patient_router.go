@@ -20,19 +20,20 @@ func NewPatientClient(patientClient pb.PatientServiceClient, logger *logrus.Logg
 		Logger:        logger,
 	}
 }
-func RegisterPatientRoutes(router *mux.Router, patientClient *PatientServerClient, AppointmentClient *appointment.AppointmentServerClient) {
+func RegisterPatientRoutes(router *mux.Router, patientClient *PatientServerClient, AppointmentClient *appointment.AppointmentServerClient, helpDesk *di.DialogFlowClient) {
 	// Public routes
 	publicRouter := router.PathPrefix("/api/v1/patient").Subrouter()
 	publicRouter.HandleFunc("/signup", patientClient.PatientSignUp).Methods("POST")
 	publicRouter.HandleFunc("/signup/verify-email", patientClient.SignUpVerify).Methods("GET")
 	publicRouter.HandleFunc("/signin", patientClient.PatientSignIn).Methods("POST")
 	publicRouter.HandleFunc("/logout", patientClient.PatientLogout).Methods("POST")
-	publicRouter.HandleFunc("/help-desk/callback", di.HelpDeskHandler).Methods("POST")
-	publicRouter.HandleFunc("/ws", patientClient.PatientChatHandler)
+	publicRouter.HandleFunc("/token/refresh", middleware.RefreshHandler("patient")).Methods("POST")
+	publicRouter.HandleFunc("/help-desk/callback", helpDesk.HelpDeskHandler).Methods("POST")
 
 	// Private routes that require JWT middleware
 	privateRouter := router.PathPrefix("/api/v1/patient").Subrouter()
 	privateRouter.Use(middleware.JWTMiddleware("patient"))
+	privateRouter.HandleFunc("/logout-all", middleware.LogoutEverywhereHandler("patient")).Methods("POST")
 	privateRouter.HandleFunc("/profile", patientClient.GetPatientProfile).Methods("GET")
 	privateRouter.HandleFunc("/profile", patientClient.UpdatePatientProfile).Methods("PUT")
 	privateRouter.HandleFunc("/get-availability", AppointmentClient.GetAvailability).Methods("GET")
@@ -43,6 +44,9 @@ func RegisterPatientRoutes(router *mux.Router, patientClient *PatientServerClien
 	privateRouter.HandleFunc("/get-prescription", patientClient.GetPrescriptions)
 	privateRouter.HandleFunc("/help-desk", di.HelpDeskRender)
 	privateRouter.HandleFunc("/customer-care", patientClient.PatientChatRender)
+	// The chat upgrade authenticates with the cookie, or the query token for
+	// clients that cannot set headers on a WebSocket
+	privateRouter.HandleFunc("/ws", patientClient.PatientChatHandler).Methods("GET")
 	privateRouter.HandleFunc("/video-call/{room}", patientClient.VideoCallRender)
 
 }
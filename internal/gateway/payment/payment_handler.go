@@ -1,15 +1,13 @@
 package payment
 
 import (
-	"context"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"path/filepath"
 
 	"github.com/NUHMANUDHEENT/hosp-connect-pb/proto/payment"
+	"github.com/sirupsen/logrus"
 )
 
 type RazorpayWebhookRequest struct {
@@ -48,7 +46,6 @@ type RazorpayPaymentEntity struct {
 // LoadPaymentPage serves the payment page to the client
 func (p *PaymentServerClient) LoadPaymentPage(w http.ResponseWriter, r *http.Request) {
 	paymentPagePath := filepath.Join("templates", "payment.html")
-	fmt.Println("hiiiii")
 	http.ServeFile(w, r, paymentPagePath)
 }
 func (p *PaymentServerClient) PaymentCallBack(w http.ResponseWriter, r *http.Request) {
@@ -58,16 +55,12 @@ func (p *PaymentServerClient) PaymentCallBack(w http.ResponseWriter, r *http.Req
 		http.Error(w, "Invalid request", http.StatusBadRequest)
 		return
 	}
-	// signature := r.Header.Get("x-razorpay-signature")
-	// fmt.Println("sign", signature)
-	// if !verifySignature("ciivOcvarUcV6uSV7WniDwfj", body, signature) {
-	// 	log.Println("Invalid signature")
-	// 	return
-	// }
-
 	// Unmarshal the JSON request
 	if err := json.Unmarshal(body, &webhookReq); err != nil {
-		log.Println("Failed to parse request body", http.StatusBadRequest)
+		p.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "PaymentCallBack",
+			"error":    err.Error(),
+		}).Error("Failed to parse Razorpay callback body")
 		return
 	}
 	// Extract payment details
@@ -82,9 +75,13 @@ func (p *PaymentServerClient) PaymentCallBack(w http.ResponseWriter, r *http.Req
 	if status == "authorized" {
 		return
 	}
-	log.Printf("Received Razorpay payment callback: OrderID: %s, PaymentID: %s,patientId: %s, Status: %s", orderID, paymentID, patientId, status)
+	p.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"function": "PaymentCallBack",
+		"orderId":  orderID,
+		"status":   status,
+	}).Info("Received Razorpay payment callback")
 
-	resp, err := p.PaymentClient.PaymentCallback(context.Background(), &payment.PaymentCallBackRequest{
+	resp, err := p.PaymentClient.PaymentCallback(r.Context(), &payment.PaymentCallBackRequest{
 		PaymentId: paymentID,
 		Status:    status,
 		OrderId:   orderID,
@@ -92,17 +89,26 @@ func (p *PaymentServerClient) PaymentCallBack(w http.ResponseWriter, r *http.Req
 		Amount:    float64(amount) / 100,
 	})
 	if err != nil {
-		log.Printf("Order ID %v payment failed with status %v", orderID, status)
+		p.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+			"function": "PaymentCallBack",
+			"orderId":  orderID,
+			"status":   status,
+			"error":    err.Error(),
+		}).Error("Payment confirmation failed")
 		return
 	}
 
-	log.Printf("Payment confirmation successful. Status: %s", resp)
+	p.logger.WithContext(r.Context()).WithFields(logrus.Fields{
+		"function": "PaymentCallBack",
+		"orderId":  orderID,
+		"success":  resp.GetSuccess(),
+	}).Info("Payment confirmation successful")
 
 	// Respond to Razorpay with a success status
 	w.WriteHeader(http.StatusOK)
 	_, err = w.Write([]byte("Webhook received"))
 	if err != nil {
-		log.Println("Failed to write response", err)
+		p.logger.WithContext(r.Context()).WithError(err).Error("Failed to write Razorpay callback response")
 		return
 	}
 
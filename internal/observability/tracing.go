@@ -0,0 +1,88 @@
+// Package observability sets up the exporters of the gateway's telemetry
+package observability
+
+import (
+	"context"
+	"os"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartTracing installs the W3C trace context propagator and, unless the exporter is
+// none, a tracer provider that exports the spans. The returned function
+// flushes the spans still buffered, call it when the gateway stops.
+func StartTracing(ctx context.Context, t config.TracingConfig) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if t.Exporter == config.ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := newExporter(ctx, t)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(t.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(skipHealthChecks{sdktrace.ParentBased(sdktrace.TraceIDRatioBased(t.SampleRatio))}),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, t config.TracingConfig) (sdktrace.SpanExporter, error) {
+	if t.Exporter == config.ExporterStdout {
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	}
+	if t.Protocol == config.OTLPHTTP {
+		var options []otlptracehttp.Option
+		if t.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpointURL(t.Endpoint))
+		}
+		if t.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, options...)
+	}
+	var options []otlptracegrpc.Option
+	if t.Endpoint != "" {
+		options = append(options, otlptracegrpc.WithEndpoint(t.Endpoint))
+	}
+	if t.Insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	return otlptracegrpc.New(ctx, options...)
+}
+
+// healthCheckSpan is the span name otelgrpc gives the upstream health probes
+const healthCheckSpan = "grpc.health.v1.Health/Check"
+
+// skipHealthChecks drops the spans of the background health probes, which
+// would otherwise start a trace per upstream every check interval
+type skipHealthChecks struct {
+	sdktrace.Sampler
+}
+
+func (s skipHealthChecks) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Name == healthCheckSpan && !trace.SpanContextFromContext(p.ParentContext).IsValid() {
+		return sdktrace.SamplingResult{Decision: sdktrace.Drop}
+	}
+	return s.Sampler.ShouldSample(p)
+}
+
+func (s skipHealthChecks) Description() string {
+	return "SkipHealthChecks{" + s.Sampler.Description() + "}"
+}
@@ -0,0 +1,316 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// Circuit breaker states
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// breakerBuckets is the number of slices the rolling window is split into
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	start                  time.Time
+	calls, failures, slows int
+}
+
+// Breaker is the circuit breaker of one upstream. It is closed while the
+// upstream is healthy, opens when too many calls fail or are slow, and after
+// OpenFor lets a few trial calls through (half-open) to decide whether to close.
+type Breaker struct {
+	Name string
+
+	mu       sync.Mutex
+	config   config.BreakerConfig
+	state    string
+	openedAt time.Time
+	buckets  [breakerBuckets]breakerBucket
+	trials   int // trial calls started in half-open
+	passed   int // trial calls that succeeded
+	// generation changes with the state, outcomes of calls started in an
+	// earlier state are ignored
+	generation uint64
+}
+
+func NewBreaker(name string, cfg config.BreakerConfig) *Breaker {
+	b := &Breaker{Name: name, config: cfg}
+	b.setState(BreakerClosed)
+	return b
+}
+
+// Configure replaces the thresholds, the current state is kept
+func (b *Breaker) Configure(cfg config.BreakerConfig) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.config = cfg
+	if cfg.Disabled && b.state != BreakerClosed {
+		b.reset()
+		b.setState(BreakerClosed)
+	}
+}
+
+// State returns closed, open or half_open
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// setState moves to state and updates the gauges, the caller holds mu
+func (b *Breaker) setState(state string) {
+	if b.state != "" && b.state != state {
+		log.Printf("Circuit breaker of %s service is now %s", b.Name, state)
+	}
+	if b.state != state {
+		b.generation++
+	}
+	b.state = state
+	for _, s := range []string{BreakerClosed, BreakerOpen, BreakerHalfOpen} {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		di.UpstreamBreakerState.WithLabelValues(b.Name, s).Set(value)
+	}
+}
+
+func (b *Breaker) reset() {
+	b.buckets = [breakerBuckets]breakerBucket{}
+	b.trials, b.passed = 0, 0
+}
+
+// allow reports whether a call may go out and the generation to record its
+// outcome under. When it may not, it returns how long until trial calls are
+// accepted again.
+func (b *Breaker) allow(now time.Time) (uint64, bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.config.Disabled {
+		return b.generation, true, 0
+	}
+	if b.state == BreakerOpen {
+		if wait := b.openedAt.Add(b.config.OpenFor).Sub(now); wait > 0 {
+			return 0, false, wait
+		}
+		b.reset()
+		b.setState(BreakerHalfOpen)
+	}
+	if b.state == BreakerHalfOpen {
+		if b.trials >= b.config.HalfOpenRequests {
+			// The trial calls are still out, wait for their verdict
+			return 0, false, time.Second
+		}
+		b.trials++
+	}
+	return b.generation, true, 0
+}
+
+// record adds the outcome of a call that allow let through
+func (b *Breaker) record(generation uint64, now time.Time, err error, latency time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.config.Disabled || generation != b.generation {
+		return
+	}
+	if status.Code(err) == codes.Canceled {
+		// The caller gave up, which says nothing about the upstream. Free the trial slot.
+		if b.state == BreakerHalfOpen {
+			b.trials--
+		}
+		return
+	}
+	failed := breakerFailure(err)
+	slow := b.config.SlowCallRate > 0 && latency >= b.config.SlowCallDuration
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed || slow {
+			b.open(now)
+			return
+		}
+		b.passed++
+		if b.passed >= b.config.HalfOpenRequests {
+			b.reset()
+			b.setState(BreakerClosed)
+		}
+	case BreakerClosed:
+		bucket := b.bucket(now)
+		bucket.calls++
+		if failed {
+			bucket.failures++
+		}
+		if slow {
+			bucket.slows++
+		}
+		calls, failures, slows := b.totals(now)
+		if calls < b.config.MinRequests {
+			return
+		}
+		if float64(failures)/float64(calls) >= b.config.FailureRate ||
+			(b.config.SlowCallRate > 0 && float64(slows)/float64(calls) >= b.config.SlowCallRate) {
+			b.open(now)
+		}
+	}
+}
+
+func (b *Breaker) open(now time.Time) {
+	b.openedAt = now
+	b.reset()
+	b.setState(BreakerOpen)
+}
+
+// bucket returns the bucket of now, clearing it when it held an older slice
+func (b *Breaker) bucket(now time.Time) *breakerBucket {
+	width := b.config.Window / breakerBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	start := now.Truncate(width)
+	bucket := &b.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !bucket.start.Equal(start) {
+		*bucket = breakerBucket{start: start}
+	}
+	return bucket
+}
+
+func (b *Breaker) totals(now time.Time) (calls, failures, slows int) {
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.config.Window {
+			calls += bucket.calls
+			failures += bucket.failures
+			slows += bucket.slows
+		}
+	}
+	return calls, failures, slows
+}
+
+// breakerFailure reports whether an error says the upstream is in trouble.
+// Business errors such as NotFound or InvalidArgument mean it answered fine.
+func breakerFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Internal, codes.Unknown, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// UnaryInterceptor rejects calls with Unavailable while the breaker is open.
+// Health checks bypass it so they can see the upstream recover.
+func (b *Breaker) UnaryInterceptor() grpc.UnaryClientInterceptor {
+	healthCheck := "/" + healthpb.Health_ServiceDesc.ServiceName + "/Check"
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == healthCheck {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		start := time.Now()
+		generation, ok, wait := b.allow(start)
+		if !ok {
+			di.UpstreamBreakerRejections.WithLabelValues(b.Name).Inc()
+			if trip, ok := ctx.Value(breakerTripKey{}).(*breakerTrip); ok {
+				trip.set(b.Name, wait)
+			}
+			return status.Errorf(codes.Unavailable, "%s service circuit breaker is open", b.Name)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.record(generation, time.Now(), err, time.Since(start))
+		return err
+	}
+}
+
+type breakerTripKey struct{}
+
+// breakerTrip remembers that a breaker rejected a call made for the request
+type breakerTrip struct {
+	mu         sync.Mutex
+	upstream   string
+	retryAfter time.Duration
+}
+
+func (t *breakerTrip) set(upstream string, retryAfter time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.upstream == "" || retryAfter > t.retryAfter {
+		t.upstream, t.retryAfter = upstream, retryAfter
+	}
+}
+
+func (t *breakerTrip) get() (string, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.upstream, t.retryAfter
+}
+
+// BreakerMiddleware answers 503 with Retry-After when an upstream call of the
+// request was rejected by an open breaker, whatever error response the handler
+// built for it. WebSocket upgrades are passed through untouched.
+func BreakerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		trip := &breakerTrip{}
+		r = r.WithContext(context.WithValue(r.Context(), breakerTripKey{}, trip))
+		next.ServeHTTP(&breakerWriter{ResponseWriter: w, request: r, trip: trip}, r)
+	})
+}
+
+// breakerWriter swaps the handler's response for the 503 once a breaker tripped
+type breakerWriter struct {
+	http.ResponseWriter
+	request     *http.Request
+	trip        *breakerTrip
+	wroteHeader bool
+	replaced    bool
+}
+
+func (w *breakerWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	upstream, retryAfter := w.trip.get()
+	if upstream == "" {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	w.replaced = true
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(retryAfter.Seconds())))))
+	utils.JSONStandardResponse(w.ResponseWriter, "fail", "Service temporarily unavailable",
+		fmt.Sprintf("The %s service is not responding, please retry later", upstream), http.StatusServiceUnavailable, w.request)
+}
+
+func (w *breakerWriter) Write(data []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.replaced {
+		return len(data), nil
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *breakerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,183 @@
+package upstream
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// breakerCall is one call at a time after the start of the test. A call the
+// breaker lets through ends with err after latency, unless it is held open.
+type breakerCall struct {
+	at          time.Duration
+	err         error
+	latency     time.Duration
+	held        bool
+	wantAllowed bool
+	wantState   string
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	cfg := config.BreakerConfig{
+		Window:           10 * time.Second,
+		MinRequests:      4,
+		FailureRate:      0.5,
+		SlowCallDuration: time.Second,
+		SlowCallRate:     0.75,
+		OpenFor:          5 * time.Second,
+		HalfOpenRequests: 2,
+	}
+	unavailable := status.Error(codes.Unavailable, "down")
+	notFound := status.Error(codes.NotFound, "no such patient")
+	canceled := status.Error(codes.Canceled, "client went away")
+
+	// opened fails half of MinRequests calls at the start, which opens the breaker
+	opened := []breakerCall{
+		{at: 0, wantAllowed: true, wantState: BreakerClosed},
+		{at: 0, wantAllowed: true, wantState: BreakerClosed},
+		{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+		{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerOpen},
+		{at: time.Second, wantAllowed: false, wantState: BreakerOpen},
+	}
+	tests := []struct {
+		name  string
+		calls []breakerCall
+	}{
+		{
+			name: "closed, open, half-open, closed",
+			calls: append(opened[:len(opened):len(opened)],
+				breakerCall{at: 6 * time.Second, wantAllowed: true, wantState: BreakerHalfOpen},
+				breakerCall{at: 6 * time.Second, wantAllowed: true, wantState: BreakerClosed},
+				breakerCall{at: 7 * time.Second, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+			),
+		},
+		{
+			name: "a failed trial call opens it again",
+			calls: append(opened[:len(opened):len(opened)],
+				breakerCall{at: 6 * time.Second, err: unavailable, wantAllowed: true, wantState: BreakerOpen},
+				breakerCall{at: 7 * time.Second, wantAllowed: false, wantState: BreakerOpen},
+				breakerCall{at: 12 * time.Second, wantAllowed: true, wantState: BreakerHalfOpen},
+			),
+		},
+		{
+			name: "a slow trial call opens it again",
+			calls: append(opened[:len(opened):len(opened)],
+				breakerCall{at: 6 * time.Second, latency: 2 * time.Second, wantAllowed: true, wantState: BreakerOpen},
+			),
+		},
+		{
+			name: "half-open lets only the trial calls through",
+			calls: append(opened[:len(opened):len(opened)],
+				breakerCall{at: 6 * time.Second, held: true, wantAllowed: true, wantState: BreakerHalfOpen},
+				breakerCall{at: 6 * time.Second, held: true, wantAllowed: true, wantState: BreakerHalfOpen},
+				breakerCall{at: 6 * time.Second, wantAllowed: false, wantState: BreakerHalfOpen},
+			),
+		},
+		{
+			name: "a canceled trial call frees its slot",
+			calls: append(opened[:len(opened):len(opened)],
+				breakerCall{at: 6 * time.Second, err: canceled, wantAllowed: true, wantState: BreakerHalfOpen},
+				breakerCall{at: 6 * time.Second, wantAllowed: true, wantState: BreakerHalfOpen},
+				breakerCall{at: 6 * time.Second, wantAllowed: true, wantState: BreakerClosed},
+			),
+		},
+		{
+			name: "slow calls open it",
+			calls: []breakerCall{
+				{at: 0, latency: 2 * time.Second, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, latency: 2 * time.Second, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, latency: 2 * time.Second, wantAllowed: true, wantState: BreakerOpen},
+			},
+		},
+		{
+			name: "business errors do not count",
+			calls: []breakerCall{
+				{at: 0, err: notFound, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: notFound, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: notFound, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: notFound, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "too few calls keep it closed",
+			calls: []breakerCall{
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+		{
+			name: "failures outside the window are forgotten",
+			calls: []breakerCall{
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+				{at: 0, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+				{at: 11 * time.Second, err: unavailable, wantAllowed: true, wantState: BreakerClosed},
+			},
+		},
+	}
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", cfg)
+			for i, call := range tt.calls {
+				now := start.Add(call.at)
+				generation, allowed, _ := b.allow(now)
+				if allowed != call.wantAllowed {
+					t.Fatalf("call %d: allowed = %v, want %v", i, allowed, call.wantAllowed)
+				}
+				if allowed && !call.held {
+					b.record(generation, now.Add(call.latency), call.err, call.latency)
+				}
+				if state := b.State(); state != call.wantState {
+					t.Fatalf("call %d: state %s, want %s", i, state, call.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerRetryAfter(t *testing.T) {
+	b := NewBreaker("test", config.BreakerConfig{
+		Window: 10 * time.Second, MinRequests: 1, FailureRate: 1, OpenFor: 5 * time.Second, HalfOpenRequests: 1,
+	})
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	generation, _, _ := b.allow(start)
+	b.record(generation, start, status.Error(codes.Unavailable, "down"), 0)
+
+	tests := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		{at: 0, want: 5 * time.Second},
+		{at: 2 * time.Second, want: 3 * time.Second},
+		{at: 4500 * time.Millisecond, want: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if _, allowed, wait := b.allow(start.Add(tt.at)); allowed || wait != tt.want {
+			t.Errorf("at %s: allowed %v, retry after %s, want rejected with %s", tt.at, allowed, wait, tt.want)
+		}
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := NewBreaker("test", config.BreakerConfig{
+		Window: 10 * time.Second, MinRequests: 1, FailureRate: 1, OpenFor: 5 * time.Second, HalfOpenRequests: 1,
+	})
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	generation, _, _ := b.allow(now)
+	b.record(generation, now, status.Error(codes.Unavailable, "down"), 0)
+	if state := b.State(); state != BreakerOpen {
+		t.Fatalf("state %s, want open", state)
+	}
+	// Disabling the breaker on reload closes it at once
+	b.Configure(config.BreakerConfig{Disabled: true})
+	if _, allowed, _ := b.allow(now); !allowed || b.State() != BreakerClosed {
+		t.Errorf("disabled breaker: allowed %v, state %s", allowed, b.State())
+	}
+}
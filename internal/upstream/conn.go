@@ -0,0 +1,146 @@
+package upstream
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"google.golang.org/grpc"
+)
+
+// Conn is a gRPC connection to one backend service whose target can be
+// changed while the gateway runs. Calls already started keep the connection
+// they began on, which is closed once the last of them returns.
+type Conn struct {
+	Name string
+
+	options []grpc.DialOption
+	mu      sync.Mutex // serializes Retarget and Close
+	current atomic.Pointer[upstreamConn]
+}
+
+type upstreamConn struct {
+	*grpc.ClientConn
+	target string
+
+	mu      sync.Mutex
+	active  int
+	retired bool
+}
+
+// Dial creates the connection, gRPC connects lazily on the first call
+func Dial(name, target string, options ...grpc.DialOption) (*Conn, error) {
+	u := &Conn{Name: name, options: options}
+	conn, err := u.dial(target)
+	if err != nil {
+		return nil, err
+	}
+	u.current.Store(conn)
+	return u, nil
+}
+
+func (u *Conn) dial(target string) (*upstreamConn, error) {
+	conn, err := grpc.NewClient(target, u.options...)
+	if err != nil {
+		return nil, err
+	}
+	return &upstreamConn{ClientConn: conn, target: target}, nil
+}
+
+// Target returns the address calls currently go to
+func (u *Conn) Target() string {
+	return u.current.Load().target
+}
+
+// Conn returns the current connection
+func (u *Conn) Conn() *grpc.ClientConn {
+	return u.current.Load().ClientConn
+}
+
+// Retarget dials target without sending calls to it. Committing the change
+// points new calls at target and closes the old connection once it is idle,
+// discarding it closes the new one.
+func (u *Conn) Retarget(target string) (config.Change, error) {
+	if u.Target() == target {
+		return config.Change{}, nil
+	}
+	conn, err := u.dial(target)
+	if err != nil {
+		return config.Change{}, err
+	}
+	return config.Change{
+		Commit: func() {
+			u.mu.Lock()
+			defer u.mu.Unlock()
+			old := u.current.Load()
+			u.current.Store(conn)
+			old.retire()
+		},
+		Discard: func() { conn.Close() },
+	}, nil
+}
+
+// Close closes the current connection once its calls have returned
+func (u *Conn) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.current.Load().retire()
+	return nil
+}
+
+func (u *Conn) acquire() *upstreamConn {
+	for {
+		conn := u.current.Load()
+		conn.mu.Lock()
+		// A retired connection that is still current belongs to a closed
+		// upstream, the call fails on it like on any closed connection
+		if !conn.retired || u.current.Load() == conn {
+			conn.active++
+			conn.mu.Unlock()
+			return conn
+		}
+		conn.mu.Unlock()
+		// Retarget swapped it between the load and the lock, take the new one
+	}
+}
+
+func (c *upstreamConn) release() {
+	c.mu.Lock()
+	c.active--
+	idle := c.retired && c.active == 0
+	c.mu.Unlock()
+	if idle {
+		c.Close()
+	}
+}
+
+func (c *upstreamConn) retire() {
+	c.mu.Lock()
+	c.retired = true
+	idle := c.active == 0
+	c.mu.Unlock()
+	if idle {
+		c.Close()
+	}
+}
+
+// Invoke implements grpc.ClientConnInterface
+func (u *Conn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	conn := u.acquire()
+	defer conn.release()
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+// NewStream implements grpc.ClientConnInterface. The connection is held until
+// the stream's context ends.
+func (u *Conn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn := u.acquire()
+	stream, err := conn.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		conn.release()
+		return nil, err
+	}
+	context.AfterFunc(ctx, conn.release)
+	return stream, nil
+}
@@ -0,0 +1,63 @@
+package upstream
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"google.golang.org/grpc"
+)
+
+// DeadlineMiddleware puts the deadline of the matched route on the request
+// context, every upstream call made with that context inherits it. Use it as
+// a mux middleware so the route template is known. WebSocket chats are long
+// lived and get no deadline.
+func DeadlineMiddleware(rt *config.Runtime) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			deadlines := rt.SnapshotFrom(r.Context()).Config.Deadlines
+			timeout := deadlines.Default
+			if route := mux.CurrentRoute(r); route != nil {
+				if template, err := route.GetPathTemplate(); err == nil {
+					if routeTimeout, ok := deadlines.Routes[template]; ok {
+						timeout = routeTimeout
+					}
+				}
+			}
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// DeadlineInterceptor applies the per-RPC deadlines. A call whose context has
+// no deadline at all, for example from a background job, gets the default one.
+func DeadlineInterceptor(rt *config.Runtime) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		deadlines := rt.SnapshotFrom(ctx).Config.Deadlines
+		timeout, ok := deadlines.RPCs[method]
+		if !ok {
+			if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+				timeout = deadlines.Default
+			}
+		}
+		if timeout > 0 {
+			// WithTimeout keeps the parent's deadline when it is earlier
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
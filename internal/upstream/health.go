@@ -0,0 +1,193 @@
+package upstream
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// Health states of an upstream, the names grpc.health.v1 uses
+const (
+	HealthServing    = "SERVING"
+	HealthNotServing = "NOT_SERVING"
+	HealthUnknown    = "UNKNOWN"
+)
+
+// UpstreamHealth is the result of the latest probe of one upstream
+type UpstreamHealth struct {
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Status string `json:"status"`
+	// Connectivity is the state of the gRPC channel, for example READY or TRANSIENT_FAILURE
+	Connectivity string `json:"connectivity"`
+	// Protocol is grpc.health.v1, or connectivity for upstreams that do not implement it
+	Protocol  string    `json:"protocol"`
+	Critical  bool      `json:"critical"`
+	Error     string    `json:"error,omitempty"`
+	LatencyMS float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthChecker probes the upstreams in the background so the readiness
+// endpoints answer from the latest results without calling them
+type HealthChecker struct {
+	rt        *config.Runtime
+	upstreams []*Conn
+
+	mu      sync.RWMutex
+	results map[string]UpstreamHealth
+}
+
+func NewHealthChecker(rt *config.Runtime, upstreams ...*Conn) *HealthChecker {
+	return &HealthChecker{
+		rt:        rt,
+		upstreams: upstreams,
+		results:   make(map[string]UpstreamHealth),
+	}
+}
+
+// Run probes every upstream right away and then once per check interval, until ctx ends
+func (h *HealthChecker) Run(ctx context.Context) {
+	for {
+		h.CheckAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.rt.Current().Config.Health.CheckInterval):
+		}
+	}
+}
+
+// CheckAll probes the upstreams concurrently and logs every status change
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	timeout := h.rt.Current().Config.Health.CheckTimeout
+	var wg sync.WaitGroup
+	for _, upstream := range h.upstreams {
+		wg.Add(1)
+		go func(upstream *Conn) {
+			defer wg.Done()
+			result := check(ctx, upstream, timeout)
+
+			h.mu.Lock()
+			previous, seen := h.results[upstream.Name]
+			h.results[upstream.Name] = result
+			h.mu.Unlock()
+
+			if !seen || previous.Status != result.Status {
+				if result.Error != "" {
+					log.Printf("Upstream %s at %s is %s: %s", result.Name, result.Target, result.Status, result.Error)
+				} else {
+					log.Printf("Upstream %s at %s is %s", result.Name, result.Target, result.Status)
+				}
+			}
+		}(upstream)
+	}
+	wg.Wait()
+}
+
+// check asks the upstream with grpc.health.v1. An upstream that does not
+// implement it still answered the call, so it counts as serving.
+func check(ctx context.Context, upstream *Conn, timeout time.Duration) UpstreamHealth {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	result := UpstreamHealth{
+		Name:      upstream.Name,
+		Target:    upstream.Target(),
+		Protocol:  "grpc.health.v1",
+		CheckedAt: time.Now(),
+	}
+	resp, err := healthpb.NewHealthClient(upstream).Check(ctx, &healthpb.HealthCheckRequest{})
+	result.LatencyMS = float64(time.Since(result.CheckedAt).Microseconds()) / 1000
+	switch {
+	case err == nil:
+		result.Status = resp.GetStatus().String()
+	case status.Code(err) == codes.Unimplemented:
+		result.Protocol = "connectivity"
+		result.Status = HealthServing
+	default:
+		result.Status = HealthNotServing
+		result.Error = status.Convert(err).Message()
+	}
+	result.Connectivity = upstream.Conn().GetState().String()
+	return result
+}
+
+// Status returns the latest results in upstream order, marking the critical ones.
+// Upstreams not probed yet are reported as UNKNOWN.
+func (h *HealthChecker) Status(critical []string) (bool, []UpstreamHealth) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	ready := true
+	statuses := make([]UpstreamHealth, 0, len(h.upstreams))
+	for _, upstream := range h.upstreams {
+		result, ok := h.results[upstream.Name]
+		if !ok {
+			result = UpstreamHealth{Name: upstream.Name, Target: upstream.Target(), Status: HealthUnknown}
+		}
+		result.Critical = contains(critical, upstream.Name)
+		if result.Critical && result.Status != HealthServing {
+			ready = false
+		}
+		statuses = append(statuses, result)
+	}
+	return ready, statuses
+}
+
+// LivenessHandler reports that the process is up. It does not look at the
+// upstreams, an unreachable backend is no reason to restart the gateway.
+func (h *HealthChecker) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, http.StatusOK, map[string]string{"status": "alive"})
+}
+
+// ReadinessHandler answers 503 until every critical upstream is serving.
+// It only says ready or not, the details are behind the admin endpoint.
+func (h *HealthChecker) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	ready, _ := h.Status(h.rt.SnapshotFrom(r.Context()).Config.Health.CriticalUpstreams)
+	if !ready {
+		writeProbe(w, http.StatusServiceUnavailable, map[string]string{"status": "not ready"})
+		return
+	}
+	writeProbe(w, http.StatusOK, map[string]string{"status": "ready"})
+}
+
+// StatusHandler shows the latest probe of every upstream to admins
+func (h *HealthChecker) StatusHandler(w http.ResponseWriter, r *http.Request) {
+	ready, upstreams := h.Status(h.rt.SnapshotFrom(r.Context()).Config.Health.CriticalUpstreams)
+	statusCode := http.StatusOK
+	if !ready {
+		statusCode = http.StatusServiceUnavailable
+	}
+	utils.JSONResponse(w, map[string]interface{}{
+		"ready":     ready,
+		"upstreams": upstreams,
+	}, statusCode, r)
+}
+
+// writeProbe answers a probe with a small uncached body, the access log
+// leaves these endpoints out
+func writeProbe(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(body)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
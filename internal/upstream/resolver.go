@@ -0,0 +1,49 @@
+package upstream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"google.golang.org/grpc/resolver"
+)
+
+const staticScheme = "static"
+
+// DialTarget is the gRPC target of the upstream. A static address list goes
+// through the static resolver, anything else, such as dns:///host:port, as is.
+func DialTarget(u config.UpstreamTarget) string {
+	if len(u.Addresses) > 0 {
+		return staticScheme + ":///" + strings.Join(u.Addresses, ",")
+	}
+	return u.Target
+}
+
+// staticResolver serves the comma separated addresses in the target, so
+// replacing the list is a Retarget like any other address change
+type staticResolver struct{}
+
+func (staticResolver) Scheme() string { return staticScheme }
+
+func (staticResolver) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	var addresses []resolver.Address
+	for _, address := range strings.Split(target.Endpoint(), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, resolver.Address{Addr: address})
+		}
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("static target %q has no addresses", target.URL.String())
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addresses}); err != nil {
+		return nil, err
+	}
+	return staticResolver{}, nil
+}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (staticResolver) Close()                                {}
+
+func init() {
+	resolver.Register(staticResolver{})
+}
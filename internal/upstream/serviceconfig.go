@@ -0,0 +1,84 @@
+package upstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	// Registers least_request_experimental
+	_ "google.golang.org/grpc/balancer/leastrequest"
+)
+
+// Names of the gRPC load balancing policies the balancer settings map to
+const (
+	pickFirstPolicy    = "pick_first"
+	roundRobinPolicy   = "round_robin"
+	leastRequestPolicy = "least_request_experimental"
+)
+
+// ServiceConfig returns the gRPC service config JSON of an upstream, with its
+// load balancing policy and the retry policy. gRPC adds random jitter to every backoff.
+func ServiceConfig(u config.UpstreamTarget, rc config.RetryConfig) string {
+	type methodName struct {
+		Service string `json:"service"`
+		Method  string `json:"method"`
+	}
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []methodName `json:"name"`
+		RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+	}
+	serviceConfig := struct {
+		LoadBalancingConfig []interface{}      `json:"loadBalancingConfig"`
+		MethodConfig        []methodConfig     `json:"methodConfig,omitempty"`
+		RetryThrottling     map[string]float64 `json:"retryThrottling,omitempty"`
+	}{
+		LoadBalancingConfig: []interface{}{loadBalancingConfig(u)},
+	}
+
+	if rc.Enabled() {
+		var names []methodName
+		for _, method := range rc.Methods {
+			service, name, _ := strings.Cut(strings.TrimPrefix(method, "/"), "/")
+			names = append(names, methodName{Service: service, Method: name})
+		}
+		serviceConfig.MethodConfig = []methodConfig{{
+			Name: names,
+			RetryPolicy: &retryPolicy{
+				MaxAttempts:          rc.MaxAttempts,
+				InitialBackoff:       serviceConfigDuration(rc.InitialBackoff),
+				MaxBackoff:           serviceConfigDuration(rc.MaxBackoff),
+				BackoffMultiplier:    rc.BackoffMultiplier,
+				RetryableStatusCodes: rc.RetryableCodes,
+			},
+		}}
+		// Stop retrying when most calls fail, so retries do not pile onto an outage
+		serviceConfig.RetryThrottling = map[string]float64{"maxTokens": 10, "tokenRatio": 0.1}
+	}
+	data, _ := json.Marshal(serviceConfig)
+	return string(data)
+}
+
+func serviceConfigDuration(d time.Duration) string {
+	return fmt.Sprintf("%gs", d.Seconds())
+}
+
+// loadBalancingConfig is the loadBalancingConfig entry of the service config
+func loadBalancingConfig(u config.UpstreamTarget) map[string]interface{} {
+	switch u.Balancer {
+	case config.BalanceRoundRobin:
+		return map[string]interface{}{roundRobinPolicy: struct{}{}}
+	case config.BalanceLeastRequest:
+		return map[string]interface{}{leastRequestPolicy: map[string]int{"choiceCount": 2}}
+	default:
+		return map[string]interface{}{pickFirstPolicy: struct{}{}}
+	}
+}
@@ -0,0 +1,76 @@
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/config"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// DialOptions returns the transport options for an upstream. Certificate
+// files are watched for changes until ctx ends.
+func DialOptions(ctx context.Context, t config.UpstreamTLSConfig) ([]grpc.DialOption, error) {
+	var options []grpc.DialOption
+	if t.Authority != "" {
+		options = append(options, grpc.WithAuthority(t.Authority))
+	}
+	if t.Mode == "" || t.Mode == config.UpstreamPlaintext {
+		return append(options, grpc.WithTransportCredentials(insecure.NewCredentials())), nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: t.ServerName,
+	}
+	var roots *utils.CAPool
+	if t.CAFile != "" {
+		var err error
+		if roots, err = utils.NewCAPool(t.CAFile); err != nil {
+			return nil, err
+		}
+		go roots.Watch(ctx, t.ReloadInterval)
+	}
+	if t.Mode == config.UpstreamMTLS {
+		certs, err := utils.NewCertReloader(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		go certs.Watch(ctx, t.ReloadInterval)
+		tlsConfig.GetClientCertificate = certs.GetClientCertificate
+	}
+	return append(options, grpc.WithTransportCredentials(&reloadingTLS{
+		TransportCredentials: credentials.NewTLS(tlsConfig),
+		config:               tlsConfig,
+		roots:                roots,
+	})), nil
+}
+
+// reloadingTLS verifies every new connection against the current CA bundle
+type reloadingTLS struct {
+	credentials.TransportCredentials
+	config *tls.Config
+	roots  *utils.CAPool
+}
+
+func (r *reloadingTLS) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	if r.roots == nil {
+		return r.TransportCredentials.ClientHandshake(ctx, authority, conn)
+	}
+	config := r.config.Clone()
+	config.RootCAs = r.roots.Pool()
+	return credentials.NewTLS(config).ClientHandshake(ctx, authority, conn)
+}
+
+func (r *reloadingTLS) Clone() credentials.TransportCredentials {
+	return &reloadingTLS{
+		TransportCredentials: r.TransportCredentials.Clone(),
+		config:               r.config,
+		roots:                r.roots,
+	}
+}
@@ -6,7 +6,6 @@ import (
 )
 
 func JSONResponse(w http.ResponseWriter, message interface{}, statusCode int, requestDetails *http.Request) {
-	logRequestResponse(statusCode, message, requestDetails)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 	err := json.NewEncoder(w).Encode(message)
@@ -20,12 +19,12 @@ type StandardResponse struct {
 	Error      string `json:"error"`
 	Message    string `json:"message"`
 	StatusCode int    `json:"statusCode"`
+	// RequestID is the X-Request-ID of the request, quote it when reporting a problem
+	RequestID string `json:"requestId,omitempty"`
 }
 
 // JSONStandardResponse sends a standardized JSON response
 func JSONStandardResponse(w http.ResponseWriter, status string, errorStr string, message string, statusCode int, req *http.Request) {
-
-	logRequestResponse(statusCode, message, req)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
 
@@ -34,6 +33,7 @@ func JSONStandardResponse(w http.ResponseWriter, status string, errorStr string,
 		Error:      errorStr,
 		Message:    message,
 		StatusCode: statusCode,
+		RequestID:  RequestIDFrom(req.Context()),
 	}
 
 	err := json.NewEncoder(w).Encode(response)
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CertReloader serves a certificate from files and picks up replaced files
+// without a restart, for example after a certbot renewal
+type CertReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	cert    atomic.Pointer[tls.Certificate]
+}
+
+// NewCertReloader loads the key pair and fails when it is invalid
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	c := &CertReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload reads the key pair again. A broken pair is rejected and the
+// previous certificate stays in use.
+func (c *CertReloader) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Remember the attempt so a broken pair is retried only after the files change again
+	c.modTime = latestModTime(c.certFile, c.keyFile)
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	if cert.Leaf == nil && len(cert.Certificate) > 0 {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil {
+			cert.Leaf = leaf
+		}
+	}
+	c.cert.Store(&cert)
+	return nil
+}
+
+func (c *CertReloader) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !latestModTime(c.certFile, c.keyFile).Equal(c.modTime)
+}
+
+// Watch reloads the certificate whenever its files change, until ctx ends
+func (c *CertReloader) Watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, "certificate "+c.certFile, c.changed, c.Reload)
+}
+
+// GetCertificate is a tls.Config.GetCertificate callback
+func (c *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// GetClientCertificate is a tls.Config.GetClientCertificate callback
+func (c *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return c.cert.Load(), nil
+}
+
+// CAPool is a CA bundle that picks up a replaced file without a restart
+type CAPool struct {
+	file string
+
+	mu      sync.Mutex // serializes reloads
+	modTime time.Time
+	pool    atomic.Pointer[x509.CertPool]
+}
+
+// NewCAPool loads the bundle and fails when it holds no certificate
+func NewCAPool(file string) (*CAPool, error) {
+	c := &CAPool{file: file}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadCAPool reads a PEM bundle once
+func LoadCAPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s contains no PEM certificates", file)
+	}
+	return pool, nil
+}
+
+// Reload reads the bundle again, a broken file keeps the previous pool
+func (c *CAPool) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.modTime = latestModTime(c.file)
+	pool, err := LoadCAPool(c.file)
+	if err != nil {
+		return err
+	}
+	c.pool.Store(pool)
+	return nil
+}
+
+// Pool returns the bundle loaded last
+func (c *CAPool) Pool() *x509.CertPool {
+	return c.pool.Load()
+}
+
+func (c *CAPool) changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !latestModTime(c.file).Equal(c.modTime)
+}
+
+// Watch reloads the bundle whenever the file changes, until ctx ends
+func (c *CAPool) Watch(ctx context.Context, interval time.Duration) {
+	watchFiles(ctx, interval, "CA bundle "+c.file, c.changed, c.Reload)
+}
+
+// watchFiles polls changed and calls reload when it reports a change
+func watchFiles(ctx context.Context, interval time.Duration, name string, changed func() bool, reload func() error) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !changed() {
+				continue
+			}
+			if err := reload(); err != nil {
+				log.Printf("The %s changed but could not be loaded, keeping the old one: %v", name, err)
+				continue
+			}
+			log.Printf("Reloaded %s", name)
+		}
+	}
+}
+
+func latestModTime(paths ...string) time.Time {
+	var latest time.Time
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
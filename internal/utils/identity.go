@@ -0,0 +1,34 @@
+package utils
+
+import "context"
+
+// Identity is who made a request, empty for anonymous requests
+type Identity struct {
+	UserID string
+	Role   string
+}
+
+type identityKey struct{}
+
+// TrackIdentity lets middleware that runs before authentication, such as the
+// access log, learn who made the request. Read it with IdentityFrom once the
+// handler has returned.
+func TrackIdentity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, identityKey{}, &Identity{})
+}
+
+// SetIdentity records the authenticated user on a tracked request
+func SetIdentity(ctx context.Context, userID, role string) {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		identity.UserID = userID
+		identity.Role = role
+	}
+}
+
+// IdentityFrom returns the identity recorded for the request
+func IdentityFrom(ctx context.Context) Identity {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return *identity
+	}
+	return Identity{}
+}
@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+)
+
+// RequestIDHeader carries the request id between the client, the gateway and the upstreams
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds the ids taken from clients, they end up in every log entry
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the id of the request, or "" outside of a request
+func RequestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// fallbackRequestIDs numbers the ids made while the random source fails
+var fallbackRequestIDs atomic.Uint64
+
+// NewRequestID returns a random 128 bit id in hex. Should the random source
+// fail, the id is the current time and a counter instead, which is still
+// unique within the process.
+func NewRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		binary.BigEndian.PutUint64(id[:8], uint64(time.Now().UnixNano()))
+		binary.BigEndian.PutUint64(id[8:], fallbackRequestIDs.Add(1))
+	}
+	return hex.EncodeToString(id)
+}
+
+// ValidRequestID accepts the ids of other proxies and tracing tools, such as
+// UUIDs, but nothing that could break a log line or a header
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '/', c == '+', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -24,6 +24,7 @@ func NewLogger() *logrus.Logger {
 	multiWriter := io.MultiWriter(os.Stdout, lumberjackLogger)
 	logger.SetOutput(multiWriter)
 	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.AddHook(RequestIDHook{})
 
 	return logger
 }
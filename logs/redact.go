@@ -0,0 +1,144 @@
+package logs
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted replaces every masked value
+const Redacted = "[redacted]"
+
+// redactPatterns find sensitive values inside messages and free text fields
+var redactPatterns = map[string]*regexp.Regexp{
+	"email": regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	// Ten digit mobile numbers, with or without a country code
+	"phone": regexp.MustCompile(`(\+\d{1,3}[ \-]?)?\b[6-9]\d{9}\b`),
+	// Bearer credentials, JWTs and Google access tokens
+	"token": regexp.MustCompile(`(?i)bearer\s+[A-Za-z0-9._~+/=\-]+|eyJ[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]+\.[A-Za-z0-9_\-]*|ya29\.[A-Za-z0-9._\-]+`),
+}
+
+// RedactConfig marks what must never reach the log
+type RedactConfig struct {
+	// Fields masks the value of every entry field whose name contains one of
+	// these, ignoring case, so "email" also covers googleEmail
+	Fields []string `json:"fields" yaml:"fields"`
+	// Patterns masks emails, phone numbers and tokens wherever they appear in
+	// the message or a text field: email, phone, token
+	Patterns []string `json:"patterns" yaml:"patterns"`
+}
+
+// DefaultRedactConfig masks contact details, credentials, prescriptions and chat content
+func DefaultRedactConfig() RedactConfig {
+	return RedactConfig{
+		Fields:   []string{"email", "phone", "mobile", "token", "authorization", "password", "otp", "prescription", "medicine", "chat", "message"},
+		Patterns: []string{"email", "phone", "token"},
+	}
+}
+
+func (c RedactConfig) Validate() error {
+	var errs []error
+	for _, field := range c.Fields {
+		if strings.TrimSpace(field) == "" {
+			errs = append(errs, errors.New("log.redact.fields must not contain empty names"))
+		}
+	}
+	for _, name := range c.Patterns {
+		if _, ok := redactPatterns[name]; !ok {
+			errs = append(errs, fmt.Errorf("log.redact.patterns: unknown pattern %q, use %s", name, strings.Join(patternNames(), ", ")))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func patternNames() []string {
+	names := make([]string, 0, len(redactPatterns))
+	for name := range redactPatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type redactor struct {
+	fields   []string
+	patterns []*regexp.Regexp
+}
+
+func (r *redactor) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range r.fields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) scrub(text string) string {
+	for _, pattern := range r.patterns {
+		text = pattern.ReplaceAllString(text, Redacted)
+	}
+	return text
+}
+
+// RedactHook masks the sensitive fields and values of every entry before it
+// is written. Configure swaps the settings when the config is reloaded.
+type RedactHook struct {
+	current atomic.Pointer[redactor]
+}
+
+func NewRedactHook(cfg RedactConfig) *RedactHook {
+	hook := &RedactHook{}
+	hook.Configure(cfg)
+	return hook
+}
+
+func (h *RedactHook) Configure(cfg RedactConfig) {
+	r := &redactor{}
+	for _, field := range cfg.Fields {
+		r.fields = append(r.fields, strings.ToLower(strings.TrimSpace(field)))
+	}
+	for _, name := range cfg.Patterns {
+		if pattern, ok := redactPatterns[name]; ok {
+			r.patterns = append(r.patterns, pattern)
+		}
+	}
+	h.current.Store(r)
+}
+
+func (h *RedactHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire works on the copy of the entry logrus makes for every log call, the
+// fields of a shared WithFields entry stay untouched
+func (h *RedactHook) Fire(entry *logrus.Entry) error {
+	r := h.current.Load()
+	entry.Message = r.scrub(entry.Message)
+	for key, value := range entry.Data {
+		if r.sensitive(key) {
+			if value != nil && value != "" {
+				entry.Data[key] = Redacted
+			}
+			continue
+		}
+		switch value := value.(type) {
+		case nil:
+		case string:
+			entry.Data[key] = r.scrub(value)
+		default:
+			// Errors, structs, maps and Stringers, such as a whole gRPC response,
+			// are checked in the form the formatter would print them
+			if text := fmt.Sprint(value); r.scrub(text) != text {
+				entry.Data[key] = r.scrub(text)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,20 @@
+package logs
+
+import (
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	"github.com/sirupsen/logrus"
+)
+
+// RequestIDHook adds the request id to every entry logged with the request context
+type RequestIDHook struct{}
+
+func (RequestIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (RequestIDHook) Fire(entry *logrus.Entry) error {
+	if id := utils.RequestIDFrom(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	return nil
+}
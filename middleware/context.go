@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+type contextKey int
+
+const claimsKey contextKey = iota
+
+// WithClaims returns a copy of ctx carrying the verified token claims
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	utils.SetIdentity(ctx, claims.UserId, claims.Role)
+	return context.WithValue(ctx, claimsKey, claims)
+}
+
+// ClaimsFrom returns the claims JWTMiddleware verified for the request
+func ClaimsFrom(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*Claims)
+	return claims, ok && claims != nil
+}
+
+// UserIDFrom returns the authenticated user id, or "" for anonymous requests
+func UserIDFrom(ctx context.Context) string {
+	if claims, ok := ClaimsFrom(ctx); ok {
+		return claims.UserId
+	}
+	return ""
+}
+
+// RoleFrom returns the authenticated role, or "" for anonymous requests
+func RoleFrom(ctx context.Context) string {
+	if claims, ok := ClaimsFrom(ctx); ok {
+		return claims.Role
+	}
+	return ""
+}
@@ -0,0 +1,139 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// JWK is the public part of a signing key in RFC 7517 form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKs returns every active asymmetric key. HS256 secrets are never published.
+func (m *KeyManager) PublicJWKs() JWKSet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range m.keys {
+		if !key.Active(now) {
+			continue
+		}
+		switch public := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "RSA",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				N:         encodeBase64URL(public.N.Bytes()),
+				E:         encodeBase64URL(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (public.Curve.Params().BitSize + 7) / 8
+			set.Keys = append(set.Keys, JWK{
+				KeyType:   "EC",
+				KeyID:     key.ID,
+				Use:       "sig",
+				Algorithm: key.Method.Alg(),
+				Curve:     public.Curve.Params().Name,
+				X:         encodeBase64URL(padBytes(public.X.Bytes(), size)),
+				Y:         encodeBase64URL(padBytes(public.Y.Bytes(), size)),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KeyID < set.Keys[j].KeyID })
+	return set
+}
+
+// publicAlgorithms lists the asymmetric algorithms a verifier may meet
+func (m *KeyManager) publicAlgorithms() []string {
+	seen := map[string]bool{}
+	algorithms := []string{}
+	for _, key := range m.PublicJWKs().Keys {
+		if !seen[key.Algorithm] {
+			seen[key.Algorithm] = true
+			algorithms = append(algorithms, key.Algorithm)
+		}
+	}
+	return algorithms
+}
+
+// JWKSHandler serves the public signing keys so other services can verify gateway tokens
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	manager, err := currentKeyManager()
+	if err != nil {
+		http.Error(w, "Signing keys are not configured", http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(manager.PublicJWKs()); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+// OpenIDConfigurationHandler serves the discovery document describing the gateway as a token issuer
+func OpenIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	manager, err := currentKeyManager()
+	if err != nil {
+		http.Error(w, "Signing keys are not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The issuer comes from the configuration only, request headers are under
+	// the client's control and must not end up in the published document
+	issuer := strings.TrimSuffix(manager.Issuer, "/")
+	if issuer == "" {
+		http.Error(w, "Token issuer is not configured", http.StatusNotFound)
+		return
+	}
+	document := map[string]interface{}{
+		"issuer":                                issuer,
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": manager.publicAlgorithms(),
+		"claims_supported":                      []string{"sub", "iss", "iat", "exp", "jti", "id", "role", "scopes"},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(document); err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	}
+}
+
+func encodeBase64URL(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func padBytes(data []byte, size int) []byte {
+	if len(data) >= size {
+		return data
+	}
+	padded := make([]byte, size)
+	copy(padded[size-len(data):], data)
+	return padded
+}
@@ -7,27 +7,52 @@ import (
 	"github.com/dgrijalva/jwt-go"
 )
 
-var jwtKey = []byte("my_secret_key")
-
 type Claims struct {
-	UserId string `json:"id"`
-	Role  string `json:"role"`
+	UserId string   `json:"id"`
+	Role   string   `json:"role"`
+	Scopes []string `json:"scopes,omitempty"`
+	// IssuedAtNano is iat in nanoseconds, whole seconds cannot tell a token
+	// from a revocation made in the same second
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
 	jwt.StandardClaims
 }
 
+// issuedAt returns when the token was issued, as precisely as it records it
+func (c *Claims) issuedAt() time.Time {
+	if c.IssuedAtNano != 0 {
+		return time.Unix(0, c.IssuedAtNano)
+	}
+	return time.Unix(c.IssuedAt, 0)
+}
+
 // CreateJWTToken generates a new JWT token for the user with a role
 func CreateJWTToken(UserId string, role string) (string, error) {
-	expirationTime := time.Now().Add(2 * time.Hour)
+	manager, err := currentKeyManager()
+	if err != nil {
+		return "", err
+	}
+
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	expirationTime := now.Add(accessTokenTTL)
 	claims := &Claims{
-		UserId:   UserId,
-		Role: role,
+		UserId:       UserId,
+		Role:         role,
+		Scopes:       ScopesFor(role, UserId),
+		IssuedAtNano: now.UnixNano(),
 		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			Subject:   UserId,
+			Issuer:    manager.Issuer,
+			IssuedAt:  now.Unix(),
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtKey)
+	return manager.Sign(claims)
 }
 
 func SetJWTToken(w http.ResponseWriter, token string, role string) {
@@ -35,7 +60,18 @@ func SetJWTToken(w http.ResponseWriter, token string, role string) {
 		Name:     role + "token",
 		Path:     "/",
 		Value:    token,
-		Expires:  time.Now().Add(2 * time.Hour),
+		Expires:  time.Now().Add(accessTokenTTL),
+		HttpOnly: true,
+	})
+}
+
+func clearJWTToken(w http.ResponseWriter, role string) {
+	http.SetCookie(w, &http.Cookie{
+		MaxAge:   -1,
+		Name:     role + "token",
+		Value:    "",
+		Expires:  time.Unix(0, 0),
 		HttpOnly: true,
+		Path:     "/",
 	})
 }
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// LegacyKeyID is the kid of the shared secret the gateway signed with before key rotation existed
+const LegacyKeyID = "legacy"
+
+// KeyConfig describes one signing key as it appears in configuration
+type KeyConfig struct {
+	ID        string    `json:"kid" yaml:"kid"`
+	Algorithm string    `json:"alg" yaml:"alg"`
+	Secret    string    `json:"secret,omitempty" yaml:"secret"`       // HS256 only
+	File      string    `json:"file,omitempty" yaml:"file"`           // PEM file, private key to sign or public key to verify only
+	NotAfter  time.Time `json:"not_after,omitempty" yaml:"not_after"` // stop accepting tokens signed with this key after this time
+}
+
+// SigningKey is a parsed key that can verify and, when the private part is known, sign tokens
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	NotAfter  time.Time
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// CanSign reports whether the private part of the key is available
+func (k *SigningKey) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Active reports whether tokens signed with this key are still accepted
+func (k *SigningKey) Active(now time.Time) bool {
+	return k.NotAfter.IsZero() || now.Before(k.NotAfter)
+}
+
+// KeyManager holds every key the gateway accepts and the one it currently signs with
+type KeyManager struct {
+	// Issuer is stamped as the iss claim and published in the discovery document
+	Issuer string
+
+	mu       sync.RWMutex
+	keys     map[string]*SigningKey
+	activeID string
+}
+
+func NewKeyManager() *KeyManager {
+	return &KeyManager{keys: make(map[string]*SigningKey)}
+}
+
+// AddKey registers a key for verification
+func (m *KeyManager) AddKey(key *SigningKey) error {
+	if key.ID == "" {
+		return errors.New("signing key has no kid")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.keys[key.ID]; exists {
+		return fmt.Errorf("duplicate signing key %q", key.ID)
+	}
+	m.keys[key.ID] = key
+	return nil
+}
+
+// SetActive selects the key new tokens are signed with
+func (m *KeyManager) SetActive(kid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[kid]
+	if !ok {
+		return fmt.Errorf("unknown signing key %q", kid)
+	}
+	if !key.CanSign() {
+		return fmt.Errorf("signing key %q has no private key", kid)
+	}
+	m.activeID = kid
+	return nil
+}
+
+// Sign signs the claims with the active key and stamps its kid in the header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	key, ok := m.keys[m.activeID]
+	m.mu.RUnlock()
+	if !ok {
+		return "", errors.New("no active signing key")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.signKey)
+}
+
+// Keyfunc resolves the verification key for a token from its kid header.
+// Tokens issued before rotation carry no kid and are checked against the legacy key.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = LegacyKeyID
+	}
+
+	m.mu.RLock()
+	key, ok := m.keys[kid]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if !key.Active(time.Now()) {
+		return nil, fmt.Errorf("signing key %q is retired", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %q", token.Method.Alg(), kid)
+	}
+	return key.verifyKey, nil
+}
+
+// ParseKey builds a signing key from its configuration
+func ParseKey(cfg KeyConfig) (*SigningKey, error) {
+	key := &SigningKey{ID: cfg.ID, NotAfter: cfg.NotAfter}
+
+	var pemData []byte
+	if cfg.File != "" {
+		data, err := ioutil.ReadFile(cfg.File)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", cfg.ID, err)
+		}
+		pemData = data
+	}
+
+	switch cfg.Algorithm {
+	case "HS256":
+		secret := []byte(cfg.Secret)
+		if len(secret) == 0 {
+			secret = pemData
+		}
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("key %q: HS256 needs a secret", cfg.ID)
+		}
+		key.Method = jwt.SigningMethodHS256
+		key.signKey = secret
+		key.verifyKey = secret
+	case "RS256":
+		if pemData == nil {
+			return nil, fmt.Errorf("key %q: RS256 needs a PEM file", cfg.ID)
+		}
+		key.Method = jwt.SigningMethodRS256
+		if private, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else if public, err := jwt.ParseRSAPublicKeyFromPEM(pemData); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %q: invalid RSA PEM: %v", cfg.ID, err)
+		}
+	case "ES256":
+		if pemData == nil {
+			return nil, fmt.Errorf("key %q: ES256 needs a PEM file", cfg.ID)
+		}
+		key.Method = jwt.SigningMethodES256
+		if private, err := jwt.ParseECPrivateKeyFromPEM(pemData); err == nil {
+			key.signKey = private
+			key.verifyKey = &private.PublicKey
+		} else if public, err := jwt.ParseECPublicKeyFromPEM(pemData); err == nil {
+			key.verifyKey = public
+		} else {
+			return nil, fmt.Errorf("key %q: invalid EC PEM: %v", cfg.ID, err)
+		}
+	default:
+		return nil, fmt.Errorf("key %q: unsupported algorithm %q", cfg.ID, cfg.Algorithm)
+	}
+
+	return key, nil
+}
+
+// NewKeyManagerFromConfig parses every configured key and activates activeID
+func NewKeyManagerFromConfig(configs []KeyConfig, activeID string) (*KeyManager, error) {
+	manager := NewKeyManager()
+	for _, cfg := range configs {
+		key, err := ParseKey(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := manager.AddKey(key); err != nil {
+			return nil, err
+		}
+	}
+	if err := manager.SetActive(activeID); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+var (
+	keyManagerMu sync.RWMutex
+	keyManager   *KeyManager
+)
+
+// UseKeyManager installs the key manager used by the token helpers and JWTMiddleware
+func UseKeyManager(manager *KeyManager) {
+	keyManagerMu.Lock()
+	defer keyManagerMu.Unlock()
+	keyManager = manager
+}
+
+func currentKeyManager() (*KeyManager, error) {
+	keyManagerMu.RLock()
+	defer keyManagerMu.RUnlock()
+	if keyManager == nil {
+		return nil, errors.New("jwt key manager is not configured")
+	}
+	return keyManager, nil
+}
@@ -0,0 +1,221 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// writePEM stores a DER block in a file under dir and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testKeyConfigs returns a legacy secret, a current secret, an RSA and an EC
+// key pair, a verify-only RSA public key and a retired secret and EC key
+func testKeyConfigs(t *testing.T) []KeyConfig {
+	t.Helper()
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRSA, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&otherRSA.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []KeyConfig{
+		{ID: LegacyKeyID, Algorithm: "HS256", Secret: "legacy-secret"},
+		{ID: "hs-2", Algorithm: "HS256", Secret: "current-secret"},
+		{ID: "rsa-1", Algorithm: "RS256", File: writePEM(t, dir, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))},
+		{ID: "ec-1", Algorithm: "ES256", File: writePEM(t, dir, "ec.pem", "EC PRIVATE KEY", ecDER)},
+		{ID: "rsa-verify", Algorithm: "RS256", File: writePEM(t, dir, "public.pem", "PUBLIC KEY", publicDER)},
+		{ID: "hs-old", Algorithm: "HS256", Secret: "old-secret", NotAfter: time.Now().Add(-time.Hour)},
+		{ID: "ec-old", Algorithm: "ES256", File: writePEM(t, dir, "ec-old.pem", "EC PRIVATE KEY", ecDER), NotAfter: time.Now().Add(-time.Hour)},
+	}
+}
+
+func signWith(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": "42"})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestKeyManagerKidSelection(t *testing.T) {
+	manager, err := NewKeyManagerFromConfig(testKeyConfigs(t), "hs-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedBy := func(kid string) string {
+		t.Helper()
+		if err := manager.SetActive(kid); err != nil {
+			t.Fatal(err)
+		}
+		token, err := manager.Sign(jwt.MapClaims{"sub": "42"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantKid string
+		wantErr bool
+	}{
+		{name: "current secret", token: signedBy("hs-2"), wantKid: "hs-2"},
+		{name: "rsa key", token: signedBy("rsa-1"), wantKid: "rsa-1"},
+		{name: "ec key", token: signedBy("ec-1"), wantKid: "ec-1"},
+		{name: "no kid falls back to legacy", token: signWith(t, jwt.SigningMethodHS256, "", []byte("legacy-secret"))},
+		{name: "no kid signed with another secret", token: signWith(t, jwt.SigningMethodHS256, "", []byte("current-secret")), wantErr: true},
+		{name: "unknown kid", token: signWith(t, jwt.SigningMethodHS256, "missing", []byte("current-secret")), wantErr: true},
+		{name: "kid of another secret", token: signWith(t, jwt.SigningMethodHS256, "hs-2", []byte("legacy-secret")), wantErr: true},
+		{name: "algorithm does not match the key", token: signWith(t, jwt.SigningMethodHS256, "rsa-1", []byte("current-secret")), wantErr: true},
+		{name: "retired key", token: signWith(t, jwt.SigningMethodHS256, "hs-old", []byte("old-secret")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(tt.token, manager.Keyfunc)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("token was accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("token was rejected: %v", err)
+			}
+			if kid, _ := token.Header["kid"].(string); kid != tt.wantKid {
+				t.Errorf("kid = %q, want %q", kid, tt.wantKid)
+			}
+		})
+	}
+}
+
+func TestKeyManagerRotation(t *testing.T) {
+	manager, err := NewKeyManagerFromConfig(testKeyConfigs(t), LegacyKeyID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var issued []string
+	for _, kid := range []string{LegacyKeyID, "hs-2", "rsa-1"} {
+		if err := manager.SetActive(kid); err != nil {
+			t.Fatalf("SetActive(%q): %v", kid, err)
+		}
+		token, err := manager.Sign(jwt.MapClaims{"sub": "42"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		issued = append(issued, token)
+	}
+	// Tokens signed before a rotation stay valid until their key retires
+	for i, token := range issued {
+		if _, err := jwt.Parse(token, manager.Keyfunc); err != nil {
+			t.Errorf("token %d rejected after rotation: %v", i, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		kid  string
+	}{
+		{name: "unknown key", kid: "missing"},
+		{name: "verify-only key", kid: "rsa-verify"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := manager.SetActive(tt.kid); err == nil {
+				t.Fatalf("SetActive(%q) succeeded", tt.kid)
+			}
+			// A refused rotation keeps signing with the previous key
+			token, err := manager.Sign(jwt.MapClaims{"sub": "42"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := jwt.Parse(token, manager.Keyfunc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kid := parsed.Header["kid"]; kid != "rsa-1" {
+				t.Errorf("signed with %v, want rsa-1", kid)
+			}
+		})
+	}
+
+	if _, err := NewKeyManagerFromConfig(append(testKeyConfigs(t), KeyConfig{ID: "hs-2", Algorithm: "HS256", Secret: "again"}), "hs-2"); err == nil {
+		t.Error("duplicate kid was accepted")
+	}
+}
+
+func TestPublicJWKs(t *testing.T) {
+	manager, err := NewKeyManagerFromConfig(testKeyConfigs(t), "hs-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := manager.PublicJWKs()
+
+	tests := []struct {
+		kid, kty, alg, crv string
+	}{
+		// Sorted by kid, secrets and the retired ec-old are left out
+		{kid: "ec-1", kty: "EC", alg: "ES256", crv: "P-256"},
+		{kid: "rsa-1", kty: "RSA", alg: "RS256"},
+		{kid: "rsa-verify", kty: "RSA", alg: "RS256"},
+	}
+	if len(set.Keys) != len(tests) {
+		t.Fatalf("published %d keys, want %d: %+v", len(set.Keys), len(tests), set.Keys)
+	}
+	for i, tt := range tests {
+		t.Run(tt.kid, func(t *testing.T) {
+			key := set.Keys[i]
+			if key.KeyID != tt.kid || key.KeyType != tt.kty || key.Algorithm != tt.alg || key.Curve != tt.crv || key.Use != "sig" {
+				t.Fatalf("key %d = %+v, want kid %s kty %s alg %s crv %q", i, key, tt.kid, tt.kty, tt.alg, tt.crv)
+			}
+			switch tt.kty {
+			case "RSA":
+				if key.E != "AQAB" || len(key.N) != 342 {
+					t.Errorf("RSA modulus or exponent malformed: e=%q, len(n)=%d", key.E, len(key.N))
+				}
+			case "EC":
+				// P-256 coordinates are always 32 bytes, 43 base64url characters
+				if len(key.X) != 43 || len(key.Y) != 43 {
+					t.Errorf("EC coordinates not padded: len(x)=%d, len(y)=%d", len(key.X), len(key.Y))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package middleware
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/di"
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// Attempts is the failure history of one email or client IP
+type Attempts struct {
+	Failures    int
+	LockedUntil time.Time
+}
+
+// AttemptStore keeps sign-in failure counters
+type AttemptStore interface {
+	Get(ctx context.Context, key string) (Attempts, error)
+	// Update applies fn to the record atomically and keeps it for ttl
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(*Attempts)) (Attempts, error)
+	Delete(ctx context.Context, key string) error
+}
+
+type storedAttempts struct {
+	Attempts
+	expiresAt time.Time
+}
+
+// MemoryAttemptStore is an AttemptStore for a single gateway instance
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	entries map[string]*storedAttempts
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{entries: make(map[string]*storedAttempts)}
+}
+
+func (s *MemoryAttemptStore) Get(ctx context.Context, key string) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return Attempts{}, nil
+	}
+	return entry.Attempts, nil
+}
+
+func (s *MemoryAttemptStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(*Attempts)) (Attempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, entry := range s.entries {
+		if now.After(entry.expiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &storedAttempts{}
+		s.entries[key] = entry
+	}
+	fn(&entry.Attempts)
+	entry.expiresAt = now.Add(ttl)
+	return entry.Attempts, nil
+}
+
+func (s *MemoryAttemptStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// LoginLimits controls how quickly repeated failures slow down and lock a key
+type LoginLimits struct {
+	FreeAttempts int           `json:"free_attempts" yaml:"free_attempts"` // failures allowed before backoff starts
+	BaseDelay    time.Duration `json:"base_delay" yaml:"base_delay"`       // first backoff, doubled on every further failure
+	MaxDelay     time.Duration `json:"max_delay" yaml:"max_delay"`         // longest backoff
+	LockoutAfter int           `json:"lockout_after" yaml:"lockout_after"` // failures that lock the key completely
+	LockoutFor   time.Duration `json:"lockout_for" yaml:"lockout_for"`     // length of a full lockout
+	Window       time.Duration `json:"window" yaml:"window"`               // quiet period after which the counter is forgotten
+}
+
+// DefaultEmailLimits are the per-account limits
+func DefaultEmailLimits() LoginLimits {
+	return LoginLimits{
+		FreeAttempts: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 10,
+		LockoutFor:   15 * time.Minute,
+		Window:       time.Hour,
+	}
+}
+
+// DefaultIPLimits are the per-client limits, loose enough for a clinic behind one NAT
+func DefaultIPLimits() LoginLimits {
+	return LoginLimits{
+		FreeAttempts: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Minute,
+		LockoutAfter: 100,
+		LockoutFor:   time.Hour,
+		Window:       time.Hour,
+	}
+}
+
+// LoginGuard throttles sign-in attempts per email and per client IP
+type LoginGuard struct {
+	Store       AttemptStore
+	EmailLimits LoginLimits
+	IPLimits    LoginLimits
+	// TrustForwardedFor takes the client IP from the last X-Forwarded-For entry, only safe behind a proxy that appends it
+	TrustForwardedFor bool
+}
+
+func NewLoginGuard(store AttemptStore) *LoginGuard {
+	return &LoginGuard{
+		Store:       store,
+		EmailLimits: DefaultEmailLimits(),
+		IPLimits:    DefaultIPLimits(),
+	}
+}
+
+func (g *LoginGuard) keys(role, email string, r *http.Request) (string, string) {
+	return "login:" + role + ":email:" + strings.ToLower(strings.TrimSpace(email)),
+		"login:" + role + ":ip:" + g.clientIP(r)
+}
+
+// clientIP is the address of the peer, or with TrustForwardedFor the entry the
+// trusted proxy appended last to X-Forwarded-For. Entries left of it come from
+// the client and can be anything.
+func (g *LoginGuard) clientIP(r *http.Request) string {
+	if g.TrustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if last := strings.TrimSpace(entries[len(entries)-1]); last != "" {
+				return last
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// attemptHold is the failure one attempt counted against a key in advance
+type attemptHold struct {
+	scope  string
+	key    string
+	limits LoginLimits
+	// lockedUntil is the lock the attempt set, and previous the one it replaced
+	lockedUntil time.Time
+	previous    time.Time
+	locked      bool
+}
+
+// LoginAttempt is a sign-in attempt already counted as a failure of its email
+// and IP. Parallel attempts therefore see each other before the credentials
+// are checked; the result then keeps or takes back the count.
+type LoginAttempt struct {
+	guard *LoginGuard
+	role  string
+	holds []attemptHold
+}
+
+// Reserve counts an attempt against the email and the IP. It returns how long
+// the caller has to wait instead when either of them is locked.
+func (g *LoginGuard) Reserve(ctx context.Context, role, email string, r *http.Request) (*LoginAttempt, time.Duration) {
+	emailKey, ipKey := g.keys(role, email, r)
+	attempt := &LoginAttempt{guard: g, role: role}
+	now := time.Now()
+	var wait time.Duration
+	for _, hold := range []attemptHold{
+		{scope: "email", key: emailKey, limits: g.EmailLimits},
+		{scope: "ip", key: ipKey, limits: g.IPLimits},
+	} {
+		reserved := false
+		_, err := g.Store.Update(ctx, hold.key, hold.limits.Window, func(attempts *Attempts) {
+			if remaining := attempts.LockedUntil.Sub(now); remaining > 0 {
+				if remaining > wait {
+					wait = remaining
+				}
+				return
+			}
+			reserved = true
+			hold.previous = attempts.LockedUntil
+			hold.locked = countFailure(attempts, hold.limits, now)
+			hold.lockedUntil = attempts.LockedUntil
+		})
+		if err == nil && reserved {
+			attempt.holds = append(attempt.holds, hold)
+		}
+	}
+	if wait > 0 {
+		attempt.release(ctx, attempt.holds)
+		return nil, wait
+	}
+	return attempt, 0
+}
+
+// countFailure adds a failure to attempts and locks them once limits are
+// reached. It reports whether this failure started a full lockout.
+func countFailure(attempts *Attempts, limits LoginLimits, now time.Time) bool {
+	attempts.Failures++
+	var delay time.Duration
+	switch {
+	case attempts.Failures >= limits.LockoutAfter:
+		delay = limits.LockoutFor
+	case attempts.Failures > limits.FreeAttempts:
+		exponent := float64(attempts.Failures - limits.FreeAttempts - 1)
+		delay = time.Duration(math.Min(float64(limits.BaseDelay)*math.Pow(2, exponent), float64(limits.MaxDelay)))
+	}
+	if delay > 0 {
+		attempts.LockedUntil = now.Add(delay)
+	}
+	return attempts.Failures == limits.LockoutAfter
+}
+
+// release takes the failures of holds back, along with a lock they set that
+// nothing replaced since
+func (a *LoginAttempt) release(ctx context.Context, holds []attemptHold) {
+	for _, hold := range holds {
+		a.guard.Store.Update(ctx, hold.key, hold.limits.Window, func(attempts *Attempts) {
+			if attempts.Failures > 0 {
+				attempts.Failures--
+			}
+			if attempts.LockedUntil.Equal(hold.lockedUntil) {
+				attempts.LockedUntil = hold.previous
+			}
+		})
+	}
+}
+
+// Failed keeps the counted failure. Upstream outages are not the caller's
+// fault, so for them the attempt is taken back instead.
+func (a *LoginAttempt) Failed(ctx context.Context, err error) {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted:
+		a.release(ctx, a.holds)
+		return
+	}
+	for _, hold := range a.holds {
+		if hold.locked {
+			di.LoginLockouts.WithLabelValues(a.role, hold.scope).Inc()
+		}
+	}
+}
+
+// Succeeded clears the failure counter of the email and takes the attempt
+// back from the IP
+func (a *LoginAttempt) Succeeded(ctx context.Context) {
+	for i, hold := range a.holds {
+		if hold.scope == "email" {
+			a.guard.Store.Delete(ctx, hold.key)
+			continue
+		}
+		a.release(ctx, a.holds[i:i+1])
+	}
+}
+
+var loginGuard atomic.Pointer[LoginGuard]
+
+func init() {
+	loginGuard.Store(NewLoginGuard(NewMemoryAttemptStore()))
+}
+
+// UseLoginGuard replaces the guard sign-in handlers consult. It is safe to
+// call while requests are served.
+func UseLoginGuard(guard *LoginGuard) {
+	loginGuard.Store(guard)
+}
+
+// CurrentLoginGuard returns the guard in use, for example to keep its store when changing limits
+func CurrentLoginGuard() *LoginGuard {
+	return loginGuard.Load()
+}
+
+// BeginLogin counts a sign-in attempt before the credentials are checked. A
+// throttled attempt is answered with 429 and Retry-After, and BeginLogin
+// returns nil when the handler must stop.
+func BeginLogin(w http.ResponseWriter, r *http.Request, role, email string) *LoginAttempt {
+	attempt, wait := loginGuard.Load().Reserve(r.Context(), role, email, r)
+	if wait <= 0 {
+		return attempt
+	}
+	di.LoginRejections.WithLabelValues(role).Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	utils.JSONStandardResponse(w, "fail", "Too many sign-in attempts, try again later", "", http.StatusTooManyRequests, r)
+	return nil
+}
@@ -0,0 +1,107 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLoginGuardClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		trust     bool
+		forwarded []string
+		want      string
+	}{
+		{name: "peer address", want: "192.0.2.1"},
+		{name: "forwarded header not trusted", forwarded: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{name: "single entry", trust: true, forwarded: []string{"198.51.100.7"}, want: "198.51.100.7"},
+		{name: "entry added by the proxy", trust: true, forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "last of several headers", trust: true, forwarded: []string{"203.0.113.9", "10.0.0.1, 198.51.100.7"}, want: "198.51.100.7"},
+		{name: "empty entry", trust: true, forwarded: []string{"203.0.113.9, "}, want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/patient/signin", nil)
+			r.RemoteAddr = "192.0.2.1:51234"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			guard := &LoginGuard{TrustForwardedFor: tt.trust}
+			if got := guard.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginGuardParallelAttempts(t *testing.T) {
+	guard := NewLoginGuard(NewMemoryAttemptStore())
+	guard.EmailLimits = LoginLimits{FreeAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, LockoutAfter: 10, LockoutFor: time.Hour, Window: time.Hour}
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/patient/signin", nil)
+
+	// All attempts start before any of them hears back from upstream
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var admitted []*LoginAttempt
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if attempt, _ := guard.Reserve(context.Background(), "patient", "a@example.com", r); attempt != nil {
+				mu.Lock()
+				admitted = append(admitted, attempt)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(admitted) != guard.EmailLimits.FreeAttempts+1 {
+		t.Fatalf("%d parallel attempts admitted, want %d", len(admitted), guard.EmailLimits.FreeAttempts+1)
+	}
+	for _, attempt := range admitted {
+		attempt.Failed(context.Background(), nil)
+	}
+	if _, wait := guard.Reserve(context.Background(), "patient", "a@example.com", r); wait <= 0 {
+		t.Error("attempt after the failures was admitted")
+	}
+}
+
+func TestLoginAttemptOutcome(t *testing.T) {
+	tests := []struct {
+		name         string
+		finish       func(*LoginAttempt)
+		wantFailures int
+	}{
+		{name: "wrong password", finish: func(a *LoginAttempt) { a.Failed(context.Background(), nil) }, wantFailures: 1},
+		{name: "upstream unavailable", finish: func(a *LoginAttempt) {
+			a.Failed(context.Background(), status.Error(codes.Unavailable, "down"))
+		}},
+		{name: "success", finish: func(a *LoginAttempt) { a.Succeeded(context.Background()) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewLoginGuard(NewMemoryAttemptStore())
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/patient/signin", nil)
+			attempt, _ := guard.Reserve(context.Background(), "patient", "a@example.com", r)
+			if attempt == nil {
+				t.Fatal("first attempt was throttled")
+			}
+			tt.finish(attempt)
+
+			emailKey, ipKey := guard.keys("patient", "a@example.com", r)
+			for _, key := range []string{emailKey, ipKey} {
+				attempts, _ := guard.Store.Get(context.Background(), key)
+				if attempts.Failures != tt.wantFailures {
+					t.Errorf("%s: %d failures, want %d", key, attempts.Failures, tt.wantFailures)
+				}
+			}
+		})
+	}
+}
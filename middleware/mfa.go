@@ -0,0 +1,364 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+const (
+	// mfaPendingAudience marks tokens that only prove the password step
+	mfaPendingAudience = "mfa-pending"
+	mfaPendingTTL      = 5 * time.Minute
+	recoveryCodeCount  = 10
+)
+
+var (
+	errMFAInvalidCode  = errors.New("invalid two-factor code")
+	errMFANotEnrolled  = errors.New("two-factor authentication is not enrolled")
+	errMFAAlreadyInUse = errors.New("two-factor authentication is already enabled")
+)
+
+// MFAEnrollment is the second factor of one user
+type MFAEnrollment struct {
+	Secret        string
+	Confirmed     bool
+	LastStep      int64    // last accepted TOTP step, refused when presented again
+	RecoveryCodes []string // sha256 hashes of unused recovery codes
+}
+
+// MFAStore keeps TOTP enrollments per role and user
+type MFAStore interface {
+	Get(ctx context.Context, role, userID string) (*MFAEnrollment, error)
+	Save(ctx context.Context, role, userID string, enrollment *MFAEnrollment) error
+	// Update runs fn on the stored enrollment atomically and saves it when fn returns nil
+	Update(ctx context.Context, role, userID string, fn func(*MFAEnrollment) error) error
+}
+
+// MemoryMFAStore is an MFAStore for a single gateway instance
+type MemoryMFAStore struct {
+	mu          sync.Mutex
+	enrollments map[string]*MFAEnrollment
+}
+
+func NewMemoryMFAStore() *MemoryMFAStore {
+	return &MemoryMFAStore{enrollments: make(map[string]*MFAEnrollment)}
+}
+
+func (s *MemoryMFAStore) Get(ctx context.Context, role, userID string) (*MFAEnrollment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enrollment, ok := s.enrollments[role+":"+userID]
+	if !ok {
+		return nil, nil
+	}
+	found := *enrollment
+	found.RecoveryCodes = append([]string(nil), enrollment.RecoveryCodes...)
+	return &found, nil
+}
+
+func (s *MemoryMFAStore) Save(ctx context.Context, role, userID string, enrollment *MFAEnrollment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *enrollment
+	s.enrollments[role+":"+userID] = &stored
+	return nil
+}
+
+func (s *MemoryMFAStore) Update(ctx context.Context, role, userID string, fn func(*MFAEnrollment) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	enrollment, ok := s.enrollments[role+":"+userID]
+	if !ok {
+		return errMFANotEnrolled
+	}
+	updated := *enrollment
+	updated.RecoveryCodes = append([]string(nil), enrollment.RecoveryCodes...)
+	if err := fn(&updated); err != nil {
+		return err
+	}
+	s.enrollments[role+":"+userID] = &updated
+	return nil
+}
+
+var mfaStore MFAStore = NewMemoryMFAStore()
+
+// UseMFAStore replaces the store TOTP enrollments are kept in
+func UseMFAStore(store MFAStore) {
+	mfaStore = store
+}
+
+// MFAChallenge tells the client to exchange MFAToken and a TOTP code for a session
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// SignInResult is what a sign-in adds to the upstream response: either the
+// issued tokens (when requested) or a second factor challenge
+type SignInResult struct {
+	*TokenResponse
+	*MFAChallenge
+}
+
+// CompleteSignIn finishes a sign-in whose password the upstream service accepted.
+// Users with a confirmed second factor get a short-lived mfa-pending token instead of a session.
+func CompleteSignIn(w http.ResponseWriter, r *http.Request, userID, role string) (*SignInResult, error) {
+	enrollment, err := mfaStore.Get(r.Context(), role, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrollment != nil && enrollment.Confirmed {
+		token, err := createMFAPendingToken(userID, role)
+		if err != nil {
+			return nil, err
+		}
+		return &SignInResult{MFAChallenge: &MFAChallenge{MFARequired: true, MFAToken: token}}, nil
+	}
+
+	tokens, err := IssueSession(w, r, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	return &SignInResult{TokenResponse: tokens}, nil
+}
+
+func createMFAPendingToken(userID, role string) (string, error) {
+	manager, err := currentKeyManager()
+	if err != nil {
+		return "", err
+	}
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		UserId:       userID,
+		Role:         role,
+		IssuedAtNano: now.UnixNano(),
+		StandardClaims: jwt.StandardClaims{
+			Audience:  mfaPendingAudience,
+			Id:        jti,
+			Subject:   userID,
+			Issuer:    manager.Issuer,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(mfaPendingTTL).Unix(),
+		},
+	}
+	return manager.Sign(claims)
+}
+
+var mfaIssuer = "HospConnect"
+
+// UseMFAIssuer sets the issuer authenticator apps show next to the account
+func UseMFAIssuer(issuer string) {
+	if issuer != "" {
+		mfaIssuer = issuer
+	}
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		secret, err := NewTOTPSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		code := secret[:5] + "-" + secret[5:10]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// MFAEnrollHandler starts a TOTP enrollment for the signed-in user and returns the otpauth URI
+func MFAEnrollHandler(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFrom(r.Context())
+		if !ok {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+
+		existing, err := mfaStore.Get(r.Context(), role, claims.UserId)
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to load two-factor settings", "", http.StatusInternalServerError, r)
+			return
+		}
+		if existing != nil && existing.Confirmed {
+			utils.JSONStandardResponse(w, "fail", errMFAAlreadyInUse.Error(), "", http.StatusConflict, r)
+			return
+		}
+
+		secret, err := NewTOTPSecret()
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to create secret", "", http.StatusInternalServerError, r)
+			return
+		}
+		if err := mfaStore.Save(r.Context(), role, claims.UserId, &MFAEnrollment{Secret: secret}); err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to save two-factor settings", "", http.StatusInternalServerError, r)
+			return
+		}
+
+		utils.JSONResponse(w, map[string]string{
+			"secret":      secret,
+			"otpauth_uri": TOTPURI(mfaIssuer, claims.UserId, secret),
+		}, http.StatusOK, r)
+	}
+}
+
+// MFAVerifyHandler confirms an enrollment with a first code and returns the one-time recovery codes
+func MFAVerifyHandler(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFrom(r.Context())
+		if !ok {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+
+		var reqBody struct {
+			Code string `json:"code" validate:"required"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			utils.JSONStandardResponse(w, "fail", "Invalid request format", "", http.StatusBadRequest, r)
+			return
+		}
+		if ok, er := utils.ValidateInput(reqBody); !ok {
+			utils.JSONStandardResponse(w, "fail", er, "", http.StatusBadRequest, r)
+			return
+		}
+
+		codes, hashes, err := newRecoveryCodes()
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to create recovery codes", "", http.StatusInternalServerError, r)
+			return
+		}
+		err = mfaStore.Update(r.Context(), role, claims.UserId, func(enrollment *MFAEnrollment) error {
+			if enrollment.Confirmed {
+				return errMFAAlreadyInUse
+			}
+			step, valid := ValidateTOTP(enrollment.Secret, reqBody.Code, time.Now())
+			if !valid {
+				return errMFAInvalidCode
+			}
+			enrollment.Confirmed = true
+			enrollment.LastStep = step
+			enrollment.RecoveryCodes = hashes
+			return nil
+		})
+		switch err {
+		case nil:
+		case errMFAInvalidCode, errMFANotEnrolled:
+			utils.JSONStandardResponse(w, "fail", err.Error(), "", http.StatusBadRequest, r)
+			return
+		case errMFAAlreadyInUse:
+			utils.JSONStandardResponse(w, "fail", err.Error(), "", http.StatusConflict, r)
+			return
+		default:
+			utils.JSONStandardResponse(w, "error", "Failed to save two-factor settings", "", http.StatusInternalServerError, r)
+			return
+		}
+
+		utils.JSONResponse(w, map[string]interface{}{
+			"status":         "success",
+			"recovery_codes": codes,
+		}, http.StatusOK, r)
+	}
+}
+
+// MFAChallengeHandler exchanges an mfa-pending token and a TOTP or recovery code for a full session
+func MFAChallengeHandler(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var reqBody struct {
+			MFAToken     string `json:"mfa_token" validate:"required"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recovery_code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+			utils.JSONStandardResponse(w, "fail", "Invalid request format", "", http.StatusBadRequest, r)
+			return
+		}
+		if ok, er := utils.ValidateInput(reqBody); !ok {
+			utils.JSONStandardResponse(w, "fail", er, "", http.StatusBadRequest, r)
+			return
+		}
+
+		claims, err := parseToken(reqBody.MFAToken)
+		if err != nil || claims.Audience != mfaPendingAudience || claims.Role != role {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+		if revoked, err := revocationStore.IsRevoked(r.Context(), claims); err != nil || revoked {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+
+		throttleKey := "mfa:" + claims.UserId
+		attempt := BeginLogin(w, r, role, throttleKey)
+		if attempt == nil {
+			return
+		}
+
+		err = mfaStore.Update(r.Context(), role, claims.UserId, func(enrollment *MFAEnrollment) error {
+			if !enrollment.Confirmed {
+				return errMFANotEnrolled
+			}
+			if reqBody.RecoveryCode != "" {
+				hash := hashRecoveryCode(reqBody.RecoveryCode)
+				for i, stored := range enrollment.RecoveryCodes {
+					if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+						enrollment.RecoveryCodes = append(enrollment.RecoveryCodes[:i], enrollment.RecoveryCodes[i+1:]...)
+						return nil
+					}
+				}
+				return errMFAInvalidCode
+			}
+			step, valid := ValidateTOTP(enrollment.Secret, reqBody.Code, time.Now())
+			if !valid || step <= enrollment.LastStep {
+				return errMFAInvalidCode
+			}
+			enrollment.LastStep = step
+			return nil
+		})
+		if err != nil {
+			attempt.Failed(r.Context(), nil)
+			utils.JSONStandardResponse(w, "fail", errMFAInvalidCode.Error(), "", http.StatusUnauthorized, r)
+			return
+		}
+		attempt.Succeeded(r.Context())
+
+		// The pending token is single use
+		revocationStore.RevokeToken(r.Context(), claims.Id, time.Unix(claims.ExpiresAt, 0))
+
+		tokens, err := IssueSession(w, r, claims.UserId, role)
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to create JWT token", "", http.StatusInternalServerError, r)
+			return
+		}
+		if tokens != nil {
+			utils.JSONResponse(w, tokens, http.StatusOK, r)
+			return
+		}
+		utils.JSONStandardResponse(w, "success", "", "Signed in", http.StatusOK, r)
+	}
+}
@@ -7,75 +7,102 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // JWTMiddleware checks if the request has a valid JWT token and the correct role
 func JWTMiddleware(role string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			c, err := r.Cookie(role + "token")
+			// Get token from the bearer header, cookie or query, in the configured order
+			tokenStr, err := TokenFromRequest(r, role)
 			if err != nil {
-				if err == http.ErrNoCookie {
-					utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusBadRequest, r)
-					return
-				}
-				utils.JSONStandardResponse(w, "fail", "Bad Request", "", http.StatusBadRequest, r)
+				utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusBadRequest, r)
 				return
 			}
 
-			// Get token from cookie
-			tokenStr := c.Value
-
 			// Parse the token
-			claims := &Claims{}
-			token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-				return jwtKey, nil
-			})
-
-			if err != nil || !token.Valid {
+			claims, err := VerifyToken(tokenStr)
+			if err != nil {
 				utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusBadRequest, r)
 				return
 			}
 
+			// Reject tokens revoked by logout or by an admin before they expire
+			revoked, err := revocationStore.IsRevoked(r.Context(), claims)
+			if err != nil || revoked {
+				utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+				return
+			}
+
 			// Check if the role matches
 			if claims.Role != role {
 				utils.JSONStandardResponse(w, "fail", "Forbidden", "", http.StatusBadRequest, r)
 				return
 			}
 
-			// Token is valid and role matches, pass to the next handler
-			next.ServeHTTP(w, r)
+			// Token is valid and role matches, tag the request span and pass the claims to the next handler
+			trace.SpanFromContext(r.Context()).SetAttributes(semconv.EnduserID(claims.UserId), semconv.EnduserRole(claims.Role))
+			next.ServeHTTP(w, r.WithContext(WithClaims(r.Context(), claims)))
 		})
 	}
 }
 
 // VerifyToken parses the JWT token string and returns the claims
 func VerifyToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
+	claims, err := parseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// A token waiting for its second factor is not an access token
+	if claims.Audience == mfaPendingAudience {
+		return nil, errors.New("second factor required")
+	}
+	return claims, nil
+}
+
+// parseToken checks the signature, expiry and issuer of any gateway-issued token
+func parseToken(tokenString string) (*Claims, error) {
+	manager, err := currentKeyManager()
+	if err != nil {
+		return nil, err
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, manager.Keyfunc)
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
 	}
+	if claims.Issuer != "" && claims.Issuer != manager.Issuer {
+		return nil, errors.New("unexpected token issuer")
+	}
 
 	return claims, nil
 }
 
-// ExtractClaimsFromCookie extracts the JWT token from the cookie, parses it, and returns the claims
+// ExtractClaimsFromCookie extracts the JWT token from the request, parses it, and returns the claims.
+// Despite the name it looks in every configured token source, not only the cookie.
+//
+// Deprecated: routes behind JWTMiddleware should read the verified claims with ClaimsFrom.
 func ExtractClaimsFromCookie(r *http.Request, role string) (*Claims, error) {
-	cookie, err := r.Cookie(role + "token")
+	tokenString, err := TokenFromRequest(r, role)
 	if err != nil {
-		return nil, fmt.Errorf("could not find cookie: %v", err)
+		return nil, fmt.Errorf("could not find token: %v", err)
 	}
 
-	tokenString := cookie.Value
-
 	claims, err := VerifyToken(tokenString)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %v", err)
 	}
 
+	revoked, err := revocationStore.IsRevoked(r.Context(), claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check token revocation: %v", err)
+	}
+	if revoked {
+		return nil, errors.New("token has been revoked")
+	}
+
 	return claims, nil
 }
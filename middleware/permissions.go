@@ -0,0 +1,122 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// PermissionConfig maps permission sets to permissions and users to permission sets.
+// A user without an assignment gets the permission set named after their role.
+type PermissionConfig struct {
+	// Sets maps a permission set name to the permissions it grants.
+	// "*" grants everything and "resource:*" every action on a resource.
+	Sets map[string][]string `json:"sets" yaml:"sets"`
+	// Assignments maps a role to user ids and the permission set each of them gets
+	Assignments map[string]map[string]string `json:"assignments" yaml:"assignments"`
+}
+
+// DefaultPermissionConfig keeps full admins working and defines the support and finance sets
+func DefaultPermissionConfig() PermissionConfig {
+	return PermissionConfig{
+		Sets: map[string][]string{
+			"admin":   {"*"},
+			"support": {"support:chat", "patients:read"},
+			"finance": {"dashboard:read"},
+			"doctor":  {},
+			"patient": {},
+		},
+		Assignments: map[string]map[string]string{},
+	}
+}
+
+var (
+	permissionsMu sync.RWMutex
+	permissions   = DefaultPermissionConfig()
+)
+
+// UsePermissions replaces the role to permission mapping
+func UsePermissions(config PermissionConfig) {
+	permissionsMu.Lock()
+	defer permissionsMu.Unlock()
+	permissions = config
+}
+
+// Validate reports malformed permissions and assignments to unknown sets
+func (c PermissionConfig) Validate() error {
+	var errs []error
+	for set, granted := range c.Sets {
+		for _, permission := range granted {
+			resource, action, scoped := strings.Cut(permission, ":")
+			if permission != "*" && (!scoped || resource == "" || action == "") {
+				errs = append(errs, fmt.Errorf("permissions.sets.%s: %q is not *, resource:action or resource:*", set, permission))
+			}
+		}
+	}
+	for role, users := range c.Assignments {
+		for user, set := range users {
+			if _, ok := c.Sets[set]; !ok {
+				errs = append(errs, fmt.Errorf("permissions.assignments.%s: user %s is assigned unknown permission set %q", role, user, set))
+			}
+		}
+	}
+	// Map order is random, keep the report stable between runs
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// ScopesFor returns the permissions a user of the given role is granted
+func ScopesFor(role, userID string) []string {
+	permissionsMu.RLock()
+	defer permissionsMu.RUnlock()
+	set := role
+	if assigned, ok := permissions.Assignments[role][userID]; ok {
+		set = assigned
+	}
+	return append([]string(nil), permissions.Sets[set]...)
+}
+
+// HasPermission reports whether the claims grant the permission. Tokens issued
+// before scopes existed fall back to the permissions of their user.
+func (c *Claims) HasPermission(permission string) bool {
+	scopes := c.Scopes
+	if scopes == nil {
+		scopes = ScopesFor(c.Role, c.UserId)
+	}
+	resource := permission
+	if i := strings.Index(permission, ":"); i >= 0 {
+		resource = permission[:i]
+	}
+	for _, scope := range scopes {
+		if scope == "*" || scope == permission || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission only lets requests through whose token grants every listed permission.
+// It must run after JWTMiddleware.
+func RequirePermission(required ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := ClaimsFrom(r.Context())
+			if !ok {
+				utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+				return
+			}
+			for _, permission := range required {
+				if !claims.HasPermission(permission) {
+					utils.JSONStandardResponse(w, "fail", "Forbidden", "", http.StatusForbidden, r)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
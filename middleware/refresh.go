@@ -0,0 +1,336 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+const (
+	accessTokenTTL  = 2 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenExpired  = errors.New("refresh token expired")
+	ErrRefreshTokenReused   = errors.New("refresh token reused")
+)
+
+// RefreshToken is the server-side record of an opaque refresh token.
+// Only the hash of the token value is kept.
+type RefreshToken struct {
+	ID        string
+	FamilyID  string
+	UserID    string
+	Role      string
+	ExpiresAt time.Time
+	Used      bool
+}
+
+// RefreshStore keeps refresh tokens grouped in families. Each rotation adds a
+// token to the family of the one it replaces.
+type RefreshStore interface {
+	Save(ctx context.Context, token *RefreshToken) error
+	Get(ctx context.Context, id string) (*RefreshToken, error)
+	// Consume marks the token as used and returns it. Presenting a token that
+	// was already used returns the record together with ErrRefreshTokenReused.
+	Consume(ctx context.Context, id string) (*RefreshToken, error)
+	RevokeFamily(ctx context.Context, familyID string) error
+	// RevokeUser revokes every family belonging to the user for the role
+	RevokeUser(ctx context.Context, userID, role string) error
+}
+
+// MemoryRefreshStore is a RefreshStore for a single gateway instance
+type MemoryRefreshStore struct {
+	mu       sync.Mutex
+	tokens   map[string]*RefreshToken
+	families map[string][]string
+}
+
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		tokens:   make(map[string]*RefreshToken),
+		families: make(map[string][]string),
+	}
+}
+
+func (s *MemoryRefreshStore) Save(ctx context.Context, token *RefreshToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now())
+	stored := *token
+	s.tokens[token.ID] = &stored
+	s.families[token.FamilyID] = append(s.families[token.FamilyID], token.ID)
+	return nil
+}
+
+func (s *MemoryRefreshStore) Get(ctx context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	found := *token
+	return &found, nil
+}
+
+func (s *MemoryRefreshStore) Consume(ctx context.Context, id string) (*RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return nil, ErrRefreshTokenNotFound
+	}
+	found := *token
+	if token.Used {
+		return &found, ErrRefreshTokenReused
+	}
+	if time.Now().After(token.ExpiresAt) {
+		return &found, ErrRefreshTokenExpired
+	}
+	token.Used = true
+	return &found, nil
+}
+
+func (s *MemoryRefreshStore) RevokeFamily(ctx context.Context, familyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, id := range s.families[familyID] {
+		delete(s.tokens, id)
+	}
+	delete(s.families, familyID)
+	return nil
+}
+
+func (s *MemoryRefreshStore) RevokeUser(ctx context.Context, userID, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for familyID, ids := range s.families {
+		for _, id := range ids {
+			token, ok := s.tokens[id]
+			if ok && token.UserID == userID && token.Role == role {
+				for _, id := range ids {
+					delete(s.tokens, id)
+				}
+				delete(s.families, familyID)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// sweep drops families whose every token has expired
+func (s *MemoryRefreshStore) sweep(now time.Time) {
+	for familyID, ids := range s.families {
+		live := false
+		for _, id := range ids {
+			if token, ok := s.tokens[id]; ok && now.Before(token.ExpiresAt) {
+				live = true
+				break
+			}
+		}
+		if !live {
+			for _, id := range ids {
+				delete(s.tokens, id)
+			}
+			delete(s.families, familyID)
+		}
+	}
+}
+
+var refreshStore RefreshStore = NewMemoryRefreshStore()
+
+// UseRefreshStore replaces the store refresh tokens are kept in
+func UseRefreshStore(store RefreshStore) {
+	refreshStore = store
+}
+
+func refreshCookieName(role string) string {
+	return role + "refresh"
+}
+
+func hashRefreshToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// IssueRefreshToken creates a refresh token in the given family (a new family
+// when familyID is empty) and sets it as the role's refresh cookie
+func IssueRefreshToken(ctx context.Context, w http.ResponseWriter, userID, role, familyID string) (string, error) {
+	value, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	if familyID == "" {
+		if familyID, err = randomToken(16); err != nil {
+			return "", err
+		}
+	}
+
+	expiresAt := time.Now().Add(refreshTokenTTL)
+	err = refreshStore.Save(ctx, &RefreshToken{
+		ID:        hashRefreshToken(value),
+		FamilyID:  familyID,
+		UserID:    userID,
+		Role:      role,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName(role),
+		Path:     "/api/v1/" + role,
+		Value:    value,
+		Expires:  expiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return value, nil
+}
+
+// IssueSession signs a fresh access token and starts a new refresh token family.
+// Sign-in handlers call it once the upstream service accepted the credentials.
+// The tokens are returned for the response body only when the client asked for them.
+func IssueSession(w http.ResponseWriter, r *http.Request, userID, role string) (*TokenResponse, error) {
+	jwtToken, err := CreateJWTToken(userID, role)
+	if err != nil {
+		return nil, err
+	}
+	SetJWTToken(w, jwtToken, role)
+
+	refreshToken, err := IssueRefreshToken(r.Context(), w, userID, role, "")
+	if err != nil {
+		return nil, err
+	}
+	if !WantsTokenInBody(r) {
+		return nil, nil
+	}
+	return newTokenResponse(jwtToken, refreshToken), nil
+}
+
+// refreshTokenFromRequest reads the refresh token from the role's cookie or,
+// for clients without cookies, from a JSON body {"refresh_token": "..."}
+func refreshTokenFromRequest(r *http.Request, role string) (string, error) {
+	if c, err := r.Cookie(refreshCookieName(role)); err == nil && c.Value != "" {
+		return c.Value, nil
+	}
+	var reqBody struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil || reqBody.RefreshToken == "" {
+		return "", errNoToken
+	}
+	return reqBody.RefreshToken, nil
+}
+
+// RevokeRefreshToken revokes the family of the refresh token the request carries and clears its cookie
+func RevokeRefreshToken(w http.ResponseWriter, r *http.Request, role string) error {
+	clearRefreshCookie(w, role)
+
+	c, err := r.Cookie(refreshCookieName(role))
+	if err != nil {
+		return nil
+	}
+	token, err := refreshStore.Get(r.Context(), hashRefreshToken(c.Value))
+	if err != nil {
+		if err == ErrRefreshTokenNotFound {
+			return nil
+		}
+		return err
+	}
+	return refreshStore.RevokeFamily(r.Context(), token.FamilyID)
+}
+
+func clearRefreshCookie(w http.ResponseWriter, role string) {
+	http.SetCookie(w, &http.Cookie{
+		MaxAge:   -1,
+		Name:     refreshCookieName(role),
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		HttpOnly: true,
+		Path:     "/api/v1/" + role,
+	})
+}
+
+// RefreshHandler exchanges the role's refresh token for a new access token and
+// rotates the refresh token. A refresh token that is presented twice revokes its whole family.
+func RefreshHandler(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := refreshTokenFromRequest(r, role)
+		if err != nil {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+
+		// Check the role and sign the new access token before the refresh token
+		// is used up, so a wrong endpoint or a signing error does not burn it
+		id := hashRefreshToken(value)
+		token, err := refreshStore.Get(r.Context(), id)
+		if err != nil {
+			clearRefreshCookie(w, role)
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+		if token.Role != role {
+			utils.JSONStandardResponse(w, "fail", "Forbidden", "", http.StatusForbidden, r)
+			return
+		}
+		jwtToken, err := CreateJWTToken(token.UserID, role)
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to create JWT token", "", http.StatusInternalServerError, r)
+			return
+		}
+
+		token, err = refreshStore.Consume(r.Context(), id)
+		if err == ErrRefreshTokenReused {
+			// Someone replayed a rotated token, so every token of the family is suspect
+			if revokeErr := refreshStore.RevokeFamily(r.Context(), token.FamilyID); revokeErr != nil {
+				utils.JSONStandardResponse(w, "error", "Failed to revoke session", "", http.StatusInternalServerError, r)
+				return
+			}
+			clearRefreshCookie(w, role)
+			utils.JSONStandardResponse(w, "fail", "Refresh token reuse detected", "", http.StatusUnauthorized, r)
+			return
+		}
+		if err != nil {
+			clearRefreshCookie(w, role)
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+		refreshToken, err := IssueRefreshToken(r.Context(), w, token.UserID, role, token.FamilyID)
+		if err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to rotate refresh token", "", http.StatusInternalServerError, r)
+			return
+		}
+		SetJWTToken(w, jwtToken, role)
+
+		if WantsTokenInBody(r) {
+			utils.JSONResponse(w, newTokenResponse(jwtToken, refreshToken), http.StatusOK, r)
+			return
+		}
+
+		utils.JSONStandardResponse(w, "success", "", "Token refreshed", http.StatusOK, r)
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// refreshStep presents one of the refresh tokens handed out so far at the
+// refresh endpoint of role. Token -1 is a value the gateway never issued.
+type refreshStep struct {
+	token      int
+	role       string
+	wantStatus int
+}
+
+func TestRefreshReuseDetection(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []refreshStep
+	}{
+		{
+			name: "every rotation hands out a working token",
+			steps: []refreshStep{
+				{token: 0, role: "patient", wantStatus: http.StatusOK},
+				{token: 1, role: "patient", wantStatus: http.StatusOK},
+				{token: 2, role: "patient", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "replaying a rotated token revokes its successor",
+			steps: []refreshStep{
+				{token: 0, role: "patient", wantStatus: http.StatusOK},
+				{token: 0, role: "patient", wantStatus: http.StatusUnauthorized},
+				{token: 1, role: "patient", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "replaying an older token revokes the whole family",
+			steps: []refreshStep{
+				{token: 0, role: "patient", wantStatus: http.StatusOK},
+				{token: 1, role: "patient", wantStatus: http.StatusOK},
+				{token: 0, role: "patient", wantStatus: http.StatusUnauthorized},
+				{token: 2, role: "patient", wantStatus: http.StatusUnauthorized},
+			},
+		},
+		{
+			name: "the wrong role endpoint does not use the token up",
+			steps: []refreshStep{
+				{token: 0, role: "doctor", wantStatus: http.StatusForbidden},
+				{token: 0, role: "patient", wantStatus: http.StatusOK},
+				{token: 1, role: "patient", wantStatus: http.StatusOK},
+			},
+		},
+		{
+			name: "unknown token",
+			steps: []refreshStep{
+				{token: -1, role: "patient", wantStatus: http.StatusUnauthorized},
+			},
+		},
+	}
+
+	manager, err := NewKeyManagerFromConfig([]KeyConfig{{ID: "test", Algorithm: "HS256", Secret: "test-secret"}}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseKeyManager(manager)
+	defer UseKeyManager(nil)
+	defer UseRefreshStore(refreshStore)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			UseRefreshStore(NewMemoryRefreshStore())
+			first, err := IssueRefreshToken(context.Background(), httptest.NewRecorder(), "42", "patient", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			issued := []string{first}
+
+			for i, step := range tt.steps {
+				value := "never-issued"
+				if step.token >= 0 {
+					value = issued[step.token]
+				}
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/"+step.role+"/token/refresh", nil)
+				r.AddCookie(&http.Cookie{Name: refreshCookieName(step.role), Value: value})
+				w := httptest.NewRecorder()
+				RefreshHandler(step.role)(w, r)
+
+				if w.Code != step.wantStatus {
+					t.Fatalf("step %d: status %d, want %d: %s", i, w.Code, step.wantStatus, w.Body)
+				}
+				if w.Code != http.StatusOK {
+					continue
+				}
+				rotated := ""
+				for _, c := range w.Result().Cookies() {
+					if c.Name == refreshCookieName(step.role) {
+						rotated = c.Value
+					}
+				}
+				if rotated == "" || rotated == value {
+					t.Fatalf("step %d: refresh token was not rotated", i)
+				}
+				issued = append(issued, rotated)
+			}
+		})
+	}
+}
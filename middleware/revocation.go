@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nuhmanudheent/hosp-connect-api-gateway/internal/utils"
+)
+
+// RevocationStore remembers access tokens that must stop working before they expire
+type RevocationStore interface {
+	// RevokeToken blocks a single token until its own expiry
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// RevokeUser blocks every token of the user issued at or before the given time
+	RevokeUser(ctx context.Context, userID, role string, before time.Time) error
+	IsRevoked(ctx context.Context, claims *Claims) (bool, error)
+}
+
+// MemoryRevocationStore is a RevocationStore whose entries expire together with
+// the tokens they block
+type MemoryRevocationStore struct {
+	mu     sync.Mutex
+	tokens map[string]time.Time
+	users  map[string]time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{
+		tokens: make(map[string]time.Time),
+		users:  make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryRevocationStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now())
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryRevocationStore) RevokeUser(ctx context.Context, userID, role string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now())
+	s.users[role+":"+userID] = before
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[claims.Id]; ok && claims.Id != "" {
+		return true, nil
+	}
+	// Compared to the nanosecond, a token issued right after the revocation stays valid
+	if before, ok := s.users[claims.Role+":"+claims.UserId]; ok && !claims.issuedAt().After(before) {
+		return true, nil
+	}
+	return false, nil
+}
+
+// sweep forgets entries that can no longer match a live token
+func (s *MemoryRevocationStore) sweep(now time.Time) {
+	for jti, expiresAt := range s.tokens {
+		if now.After(expiresAt) {
+			delete(s.tokens, jti)
+		}
+	}
+	for user, before := range s.users {
+		if now.After(before.Add(accessTokenTTL)) {
+			delete(s.users, user)
+		}
+	}
+}
+
+var revocationStore RevocationStore = NewMemoryRevocationStore()
+
+// UseRevocationStore replaces the store consulted by JWTMiddleware
+func UseRevocationStore(store RevocationStore) {
+	revocationStore = store
+}
+
+// RevokeAccessToken revokes the access token the request carries for the role, if it is valid
+func RevokeAccessToken(r *http.Request, role string) error {
+	tokenString, err := TokenFromRequest(r, role)
+	if err != nil {
+		return nil
+	}
+	claims, err := VerifyToken(tokenString)
+	if err != nil {
+		return nil
+	}
+	return revocationStore.RevokeToken(r.Context(), claims.Id, time.Unix(claims.ExpiresAt, 0))
+}
+
+// EndSession revokes the access and refresh tokens of the current session
+func EndSession(w http.ResponseWriter, r *http.Request, role string) error {
+	if err := RevokeAccessToken(r, role); err != nil {
+		return err
+	}
+	return RevokeRefreshToken(w, r, role)
+}
+
+// RevokeUserSessions invalidates every access and refresh token the user holds for the role
+func RevokeUserSessions(ctx context.Context, userID, role string) error {
+	if err := revocationStore.RevokeUser(ctx, userID, role, time.Now()); err != nil {
+		return err
+	}
+	return refreshStore.RevokeUser(ctx, userID, role)
+}
+
+// LogoutEverywhereHandler signs the caller out of every device for the role
+func LogoutEverywhereHandler(role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := ClaimsFrom(r.Context())
+		if !ok {
+			utils.JSONStandardResponse(w, "fail", "Unauthorized", "", http.StatusUnauthorized, r)
+			return
+		}
+
+		if err := RevokeUserSessions(r.Context(), claims.UserId, role); err != nil {
+			utils.JSONStandardResponse(w, "error", "Failed to revoke sessions", "", http.StatusInternalServerError, r)
+			return
+		}
+		clearJWTToken(w, role)
+		clearRefreshCookie(w, role)
+
+		utils.JSONStandardResponse(w, "success", "", "Logged out from all devices", http.StatusOK, r)
+	}
+}
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// testSession is a signed-in device with its access and refresh token
+type testSession struct {
+	userID, role    string
+	access, refresh string
+}
+
+func signIn(t *testing.T, userID, role string) testSession {
+	t.Helper()
+	access, err := CreateJWTToken(userID, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := IssueRefreshToken(context.Background(), httptest.NewRecorder(), userID, role, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSession{userID: userID, role: role, access: access, refresh: refresh}
+}
+
+// accessStatus is the status JWTMiddleware answers the access token of s with
+func (s testSession) accessStatus() int {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/"+s.role+"/profile", nil)
+	r.Header.Set("Authorization", "Bearer "+s.access)
+	w := httptest.NewRecorder()
+	JWTMiddleware(s.role)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(w, r)
+	return w.Code
+}
+
+// refreshStatus is the status the refresh endpoint answers the refresh token of s with
+func (s testSession) refreshStatus() int {
+	r := httptest.NewRequest(http.MethodPost, "/api/v1/"+s.role+"/token/refresh", nil)
+	r.AddCookie(&http.Cookie{Name: refreshCookieName(s.role), Value: s.refresh})
+	w := httptest.NewRecorder()
+	RefreshHandler(s.role)(w, r)
+	return w.Code
+}
+
+func TestRevocation(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke runs against the sessions: patient 42 on two devices,
+		// patient 43 and doctor 42
+		revoke func(t *testing.T, sessions []testSession)
+		// wantRevoked lists the sessions that must stop working
+		wantRevoked []bool
+	}{
+		{
+			name:        "nothing revoked",
+			revoke:      func(t *testing.T, sessions []testSession) {},
+			wantRevoked: []bool{false, false, false, false},
+		},
+		{
+			name: "logout ends only its own session",
+			revoke: func(t *testing.T, sessions []testSession) {
+				r := httptest.NewRequest(http.MethodPost, "/api/v1/patient/logout", nil)
+				r.Header.Set("Authorization", "Bearer "+sessions[0].access)
+				r.AddCookie(&http.Cookie{Name: refreshCookieName("patient"), Value: sessions[0].refresh})
+				if err := EndSession(httptest.NewRecorder(), r, "patient"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRevoked: []bool{true, false, false, false},
+		},
+		{
+			name: "blocking a patient ends all of their sessions",
+			revoke: func(t *testing.T, sessions []testSession) {
+				if err := RevokeUserSessions(context.Background(), "42", "patient"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantRevoked: []bool{true, true, false, false},
+		},
+	}
+
+	manager, err := NewKeyManagerFromConfig([]KeyConfig{{ID: "test", Algorithm: "HS256", Secret: "test-secret"}}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	UseKeyManager(manager)
+	defer UseKeyManager(nil)
+	defer UseRefreshStore(refreshStore)
+	defer UseRevocationStore(revocationStore)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			UseRefreshStore(NewMemoryRefreshStore())
+			UseRevocationStore(NewMemoryRevocationStore())
+			sessions := []testSession{
+				signIn(t, "42", "patient"),
+				signIn(t, "42", "patient"),
+				signIn(t, "43", "patient"),
+				signIn(t, "42", "doctor"),
+			}
+			tt.revoke(t, sessions)
+
+			for i, session := range sessions {
+				wantAccess, wantRefresh := http.StatusOK, http.StatusOK
+				if tt.wantRevoked[i] {
+					wantAccess, wantRefresh = http.StatusUnauthorized, http.StatusUnauthorized
+				}
+				if got := session.accessStatus(); got != wantAccess {
+					t.Errorf("session %d: access token answered %d, want %d", i, got, wantAccess)
+				}
+				if got := session.refreshStatus(); got != wantRefresh {
+					t.Errorf("session %d: refresh token answered %d, want %d", i, got, wantRefresh)
+				}
+			}
+
+			// Signing in again afterwards works
+			if got := signIn(t, "42", "patient").accessStatus(); got != http.StatusOK {
+				t.Errorf("new session answered %d, want %d", got, http.StatusOK)
+			}
+		})
+	}
+}
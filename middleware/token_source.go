@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TokenSource is a place a request can carry its access token in
+type TokenSource string
+
+const (
+	SourceHeader TokenSource = "header"
+	SourceCookie TokenSource = "cookie"
+	SourceQuery  TokenSource = "query"
+)
+
+// tokenDeliveryHeader lets API clients ask for tokens in the sign-in response body instead of cookies only
+const tokenDeliveryHeader = "X-Token-Delivery"
+
+var errNoToken = errors.New("no token in request")
+
+var (
+	tokenSources    = []TokenSource{SourceHeader, SourceCookie}
+	tokenQueryParam = "access_token"
+)
+
+// UseTokenSources sets the order token sources are searched in.
+// The query source is only honoured for WebSocket upgrades.
+func UseTokenSources(sources []TokenSource, queryParam string) {
+	tokenSources = sources
+	if queryParam != "" {
+		tokenQueryParam = queryParam
+	}
+}
+
+// TokenFromRequest returns the first access token found in the configured sources
+func TokenFromRequest(r *http.Request, role string) (string, error) {
+	for _, source := range tokenSources {
+		switch source {
+		case SourceHeader:
+			header := r.Header.Get("Authorization")
+			if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+				return strings.TrimSpace(header[7:]), nil
+			}
+		case SourceCookie:
+			if c, err := r.Cookie(role + "token"); err == nil && c.Value != "" {
+				return c.Value, nil
+			}
+		case SourceQuery:
+			if !websocket.IsWebSocketUpgrade(r) {
+				continue
+			}
+			if token := r.URL.Query().Get(tokenQueryParam); token != "" {
+				return token, nil
+			}
+		}
+	}
+	return "", errNoToken
+}
+
+// TokenResponse carries issued tokens in a response body for clients that cannot use cookies
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// WantsTokenInBody reports whether the client asked for tokens in the response body
+func WantsTokenInBody(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(tokenDeliveryHeader), "body")
+}
+
+func newTokenResponse(accessToken, refreshToken string) *TokenResponse {
+	return &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL / time.Second),
+		RefreshToken: refreshToken,
+	}
+}